@@ -0,0 +1,53 @@
+package mpt
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+var (
+	// ErrNotFound is returned when a key is not present in the trie.
+	ErrNotFound = errors.New("[Trie] key not found")
+	// ErrHashMismatch is returned when a node does not match the hash it is
+	// referenced by.
+	ErrHashMismatch = errors.New("[Trie] hash does not match")
+	// ErrInvalidKey is returned when a key cannot be placed in the trie.
+	ErrInvalidKey = errors.New("[Trie] Cannot insert")
+	// ErrInvalidSnapshot is returned when a snapshot cannot be decoded.
+	ErrInvalidSnapshot = errors.New("[Trie] invalid snapshot")
+	// ErrRootMismatch is returned when an imported snapshot does not rebuild
+	// the root hash it records.
+	ErrRootMismatch = errors.New("[Trie] snapshot root does not match")
+	// ErrReadOnly is returned when a read-only trie is modified.
+	ErrReadOnly = storage.ErrReadOnly
+)
+
+// ErrMissingNode is returned when a node referenced by the trie is not
+// present in the store. Path is the key prefix leading to the node, when
+// known.
+type ErrMissingNode struct {
+	Hash []byte
+	Path []byte
+	Err  error
+}
+
+func (e *ErrMissingNode) Error() string {
+	return fmt.Sprintf("[Trie] missing node %x at path %x: %v", e.Hash, e.Path, e.Err)
+}
+
+func (e *ErrMissingNode) Unwrap() error { return e.Err }
+
+func notFoundError(key []byte) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, hex.EncodeToString(key))
+}
+
+func invalidKeyError(key []byte) error {
+	return fmt.Errorf("%w: %s", ErrInvalidKey, hex.EncodeToString(key))
+}
+
+func hashMismatchError(hash []byte) error {
+	return fmt.Errorf("%w: node %x", ErrHashMismatch, hash)
+}
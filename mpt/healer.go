@@ -0,0 +1,114 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vldmkr/merkle-patricia-trie/crypto"
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+// NodeSource provides serialized nodes by their hash. Any StorageAdapter
+// satisfies it.
+type NodeSource interface {
+	Get([]byte) ([]byte, error)
+}
+
+// MapSource is a NodeSource backed by a map of node hash to serialized node,
+// as returned by Trie.CreateSnapshot.
+type MapSource map[string][]byte
+
+func (s MapSource) Get(hash []byte) ([]byte, error) {
+	if data, ok := s[string(hash)]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("[Source] %w: %x", storage.ErrNotFound, hash)
+}
+
+// NewPersistTrieSource returns a NodeSource serving the nodes of a blob
+// produced by Trie.Serialize.
+func NewPersistTrieSource(data []byte) (NodeSource, error) {
+	persistTrie := PersistTrie{}
+	err := cbor.Unmarshal(data, &persistTrie)
+	if err != nil {
+		return nil, err
+	}
+	source := make(MapSource, len(persistTrie.Pairs))
+	for _, pair := range persistTrie.Pairs {
+		source[string(pair.Key)] = pair.Value
+	}
+	return source, nil
+}
+
+// NewSnapshotFileSource returns a NodeSource serving the nodes of a file
+// written by MemoryAdapter.ExportSnapshot.
+func NewSnapshotFileSource(filename string) (NodeSource, error) {
+	store := storage.NewMemoryAdapter()
+	err := store.ImportSnapshot(filename)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Healer restores nodes that are missing from a store, or fail their hash
+// check, by fetching them from a NodeSource.
+type Healer struct {
+	store  storage.StorageAdapter
+	source NodeSource
+}
+
+func NewHealer(store storage.StorageAdapter, source NodeSource) *Healer {
+	return &Healer{
+		store:  store,
+		source: source,
+	}
+}
+
+// Heal walks the trie rooted at root and writes back every node that cannot
+// be loaded from the store. Only missing or corrupted nodes are fetched from
+// the source. It returns the number of repaired nodes.
+func (h *Healer) Heal(root []byte) (int, error) {
+	if len(root) == 0 {
+		return 0, nil
+	}
+	repaired := 0
+	visited := make(map[string]bool)
+	pending := [][]byte{root}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if visited[string(hash)] {
+			continue
+		}
+		visited[string(hash)] = true
+
+		data, err := h.store.Get(hash)
+		if err != nil || !verifyHash(hash, data) {
+			data, err = h.source.Get(hash)
+			if err != nil {
+				return repaired, fmt.Errorf("[Healer] cannot fetch node %x: %w", hash, err)
+			}
+			if !verifyHash(hash, data) {
+				return repaired, hashMismatchError(hash)
+			}
+			err = h.store.Put(hash, data)
+			if err != nil {
+				return repaired, err
+			}
+			repaired++
+		}
+		node, err := DeserializeNode(data)
+		if err != nil {
+			return repaired, err
+		}
+		pending = append(pending, childHashes(node)...)
+	}
+	return repaired, nil
+}
+
+func verifyHash(hash, data []byte) bool {
+	calculatedHash := crypto.MainHash(data)
+	return bytes.Equal(calculatedHash[:], hash)
+}
@@ -0,0 +1,85 @@
+package mpt
+
+import (
+	"testing"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+func TestHealMissingNodes(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	keys := []string{"123456", "134567", "123467", "234567", "1234567890", "12345678"}
+	for _, key := range keys {
+		err := trie.Put([]byte(key), []byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	trie.Commit()
+	root := trie.RootHash()
+	data, err := trie.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewPersistTrieSource(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lose a few nodes, including the root, and corrupt another one.
+	lost := 0
+	for hash := range trie.CreateSnapshot() {
+		if lost < 3 || string(root) == hash {
+			store.Delete([]byte(hash))
+			lost++
+		}
+	}
+	for hash := range trie.CreateSnapshot() {
+		if store.Has([]byte(hash)) {
+			store.Put([]byte(hash), []byte("garbage"))
+			lost++
+			break
+		}
+	}
+
+	repaired, err := NewHealer(store, source).Heal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired != lost {
+		t.Errorf("Expected %d repaired nodes, got %d", lost, repaired)
+	}
+
+	rootNode := HashNode(root)
+	trie = New(&rootNode, store)
+	for _, key := range keys {
+		value, err := trie.Get([]byte(key))
+		if err != nil || string(value) != key {
+			t.Errorf("Expected %s, got %s (err: %v)", key, value, err)
+		}
+	}
+
+	repaired, err = NewHealer(store, source).Heal(root)
+	if err != nil || repaired != 0 {
+		t.Errorf("Expected healthy trie, got %d repaired (err: %v)", repaired, err)
+	}
+}
+
+func TestHealRejectsBadSource(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	trie.Put([]byte("123456"), []byte("A"))
+	trie.Commit()
+	root := trie.RootHash()
+	store.Delete(root)
+
+	source := MapSource{string(root): []byte("garbage")}
+	_, err := NewHealer(store, source).Heal(root)
+	if err == nil {
+		t.Error("Expected hash mismatch error")
+	}
+	if store.Has(root) {
+		t.Error("Unverified node was written to the store")
+	}
+}
@@ -2,8 +2,7 @@ package mpt
 
 import (
 	"bytes"
-	"encoding/base64"
-	"encoding/json"
+	"context"
 	"errors"
 	fmt "fmt"
 	"os"
@@ -171,19 +170,55 @@ func (hn *HashNode) Hash() []byte                      { return []byte(*hn) }
 func (hn *HashNode) Serialize() []byte                 { return nil }
 func (hn *HashNode) Save(store storage.StorageAdapter) {}
 
+// childHashes returns the hashes of all direct children of node.
+func childHashes(node Node) [][]byte {
+	var hashes [][]byte
+	switch n := node.(type) {
+	case *FullNode:
+		for _, child := range n.Children {
+			if child != nil {
+				hashes = append(hashes, child.Hash())
+			}
+		}
+	case *ShortNode:
+		hashes = append(hashes, n.Value.Hash())
+	}
+	return hashes
+}
+
 // Snapshot Management
 
 var snapshotLock sync.RWMutex
 
 func (t *Trie) CreateSnapshot() map[string][]byte {
+	snapshot, _ := t.CreateSnapshotContext(context.Background())
+	return snapshot
+}
+
+// CreateSnapshotContext collects every node of the trie keyed by node hash,
+// loading nodes from the store as needed. It stops when ctx is done.
+func (t *Trie) CreateSnapshotContext(ctx context.Context) (map[string][]byte, error) {
 	snapshotLock.RLock()
 	defer snapshotLock.RUnlock()
+	// resolving nodes caches hashes and records witnesses
+	t.lock.Lock()
+	defer t.lock.Unlock()
 
 	snapshot := make(map[string][]byte)
-	var collectNodes func(Node)
-	collectNodes = func(node Node) {
+	var collectNodes func(Node) error
+	collectNodes = func(node Node) error {
 		if node == nil {
-			return
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if n, ok := node.(*HashNode); ok {
+			loadedNode, err := t.resolve(ctx, n, nil)
+			if err != nil {
+				return err
+			}
+			node = loadedNode
 		}
 		data := node.Serialize()
 		snapshot[string(node.Hash())] = data
@@ -191,75 +226,102 @@ func (t *Trie) CreateSnapshot() map[string][]byte {
 		switch n := node.(type) {
 		case *FullNode:
 			for _, child := range n.Children {
-				collectNodes(child)
+				if err := collectNodes(child); err != nil {
+					return err
+				}
 			}
 		case *ShortNode:
-			collectNodes(n.Value)
+			return collectNodes(n.Value)
 		}
+		return nil
 	}
 
-	collectNodes(t.root)
-	return snapshot
+	err := collectNodes(t.root)
+	return snapshot, err
 }
 
-// Iterate applies a function to each key-value pair in the trie.
+// Iterate applies a function to each key-value pair in the trie, in key
+// order.
 func (t *Trie) Iterate(fn func(key, value []byte)) {
-	var iterate func(node Node, prefix []byte)
-	iterate = func(node Node, prefix []byte) {
+	t.IterateContext(context.Background(), fn)
+}
+
+// IterateContext is like Iterate but loads nodes from the store as needed
+// and stops when ctx is done. The trie is locked during the walk, so fn must
+// not call its methods.
+func (t *Trie) IterateContext(ctx context.Context, fn func(key, value []byte)) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.iterate(ctx, fn)
+}
+
+// iterate walks the trie for IterateContext. The lock must be held.
+func (t *Trie) iterate(ctx context.Context, fn func(key, value []byte)) error {
+	var iterate func(node Node, prefix []byte) error
+	iterate = func(node Node, prefix []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if n, ok := node.(*HashNode); ok {
+			loadedNode, err := t.resolve(ctx, n, prefix)
+			if err != nil {
+				return err
+			}
+			node = loadedNode
+		}
+		// cap the prefix so that appending to it always copies
+		prefix = prefix[:len(prefix):len(prefix)]
 		switch n := node.(type) {
 		case *FullNode:
-			for i, child := range n.Children {
-				if child != nil {
-					iterate(child, append(prefix, byte(i)))
+			if n.Children[256] != nil {
+				if err := iterate(n.Children[256], prefix); err != nil {
+					return err
+				}
+			}
+			for i := 0; i < 256; i++ {
+				if n.Children[i] != nil {
+					if err := iterate(n.Children[i], append(prefix, byte(i))); err != nil {
+						return err
+					}
 				}
 			}
 		case *ShortNode:
-			iterate(n.Value, append(prefix, n.Key...))
+			return iterate(n.Value, append(prefix, n.Key...))
 		case *ValueNode:
 			fn(prefix, n.Value)
 		}
+		return nil
+	}
+	if t.root == nil {
+		return nil
 	}
-	iterate(t.root, nil)
+	return iterate(t.root, nil)
 }
-func (t *Trie) ExportSnapshot(filename string) error {
-	data := make(map[string]string)
-	t.Iterate(func(key, value []byte) {
-		data[string(key)] = base64.StdEncoding.EncodeToString(value)
-	})
 
+// ExportSnapshot writes the trie to a file with WriteSnapshot.
+func (t *Trie) ExportSnapshot(filename string) error {
 	file, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(data)
+	err = t.WriteSnapshot(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
 }
 
+// ImportSnapshot replaces the content of the trie with a file written by
+// ExportSnapshot, as ReadSnapshot does.
 func (t *Trie) ImportSnapshot(filename string) error {
-	fmt.Println("Starting ImportSnapshot")
 	file, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	data := make(map[string]string)
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&data); err != nil {
-		return err
-	}
-
-	for key, value := range data {
-		decodedValue, err := base64.StdEncoding.DecodeString(value)
-		if err != nil {
-			return err
-		}
-		t.Put([]byte(key), decodedValue)
-	}
-	return nil
+	return t.ReadSnapshot(file)
 }
 
 func ValidateSnapshot(snapshot map[string]Node) bool {
@@ -0,0 +1,46 @@
+package mpt
+
+import (
+	"errors"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+// FindOrphans returns the keys of store that are not reachable from any of
+// the given roots. The store must implement storage.Iteratee and is expected
+// to hold only trie nodes.
+func FindOrphans(store storage.StorageAdapter, roots [][]byte) ([][]byte, error) {
+	iteratee, ok := store.(storage.Iteratee)
+	if !ok {
+		return nil, errors.New("[Trie] store cannot be iterated")
+	}
+	reachable := make(map[string]bool)
+	pending := append([][]byte{}, roots...)
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if len(hash) == 0 || reachable[string(hash)] {
+			continue
+		}
+		data, err := store.Get(hash)
+		if err != nil {
+			return nil, &ErrMissingNode{Hash: hash, Err: err}
+		}
+		node, err := DeserializeNode(data)
+		if err != nil {
+			return nil, err
+		}
+		reachable[string(hash)] = true
+		pending = append(pending, childHashes(node)...)
+	}
+
+	var orphans [][]byte
+	it := iteratee.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if !reachable[string(it.Key())] {
+			orphans = append(orphans, append([]byte{}, it.Key()...))
+		}
+	}
+	return orphans, it.Error()
+}
@@ -0,0 +1,84 @@
+package mpt
+
+import (
+	"os"
+	"testing"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+func TestFindOrphans(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	trie.Put([]byte("123456"), []byte("A"))
+	trie.Put([]byte("134567"), []byte("B"))
+	trie.Commit()
+	root1 := trie.RootHash()
+	trie.Put([]byte("123456"), []byte("C"))
+	trie.Commit()
+	root2 := trie.RootHash()
+
+	orphans, err := FindOrphans(store, [][]byte{root1, root2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 0 {
+		t.Errorf("Expected no orphans, got %d", len(orphans))
+	}
+
+	orphans, err = FindOrphans(store, [][]byte{root2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the old root, the full node below it, the short node and the value
+	if len(orphans) != 4 {
+		t.Errorf("Expected 4 orphans, got %d", len(orphans))
+	}
+	for _, hash := range orphans {
+		store.Delete(hash)
+	}
+	rootNode := HashNode(root2)
+	trie = New(&rootNode, store)
+	value, err := trie.Get([]byte("123456"))
+	if err != nil || string(value) != "C" {
+		t.Errorf("Expected C, got %s (err: %v)", value, err)
+	}
+}
+
+func TestFindOrphansPrefixed(t *testing.T) {
+	dir, err := os.MkdirTemp("", "leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := storage.NewLevelDBAdapter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	accounts := storage.NewPrefixedAdapter(db, []byte("accounts/"))
+	receipts := storage.NewPrefixedAdapter(db, []byte("receipts/"))
+	accountTrie := New(nil, accounts)
+	receiptTrie := New(nil, receipts)
+	accountTrie.Put([]byte("123456"), []byte("A"))
+	receiptTrie.Put([]byte("123456"), []byte("R"))
+	receiptTrie.Put([]byte("134567"), []byte("S"))
+	accountTrie.Commit()
+	receiptTrie.Commit()
+
+	orphans, err := FindOrphans(accounts, [][]byte{accountTrie.RootHash()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 0 {
+		t.Errorf("Expected no orphans in accounts, got %d", len(orphans))
+	}
+	orphans, err = FindOrphans(receipts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != len(receiptTrie.CreateSnapshot()) {
+		t.Errorf("Expected every receipt node to be orphaned, got %d", len(orphans))
+	}
+}
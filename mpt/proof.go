@@ -0,0 +1,133 @@
+package mpt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vldmkr/merkle-patricia-trie/crypto"
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+// ProveMany returns a single proof of the value or absence of every key
+// against the current root hash. Nodes shared by several keys are included
+// only once.
+func (t *Trie) ProveMany(keys [][]byte) ([]byte, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	proof := &PersistMultiProof{}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		err := t.prove(t.root, key, proof, seen)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cbor.Marshal(proof)
+}
+
+func (t *Trie) prove(node Node, key []byte, proof *PersistMultiProof, seen map[string]bool) error {
+	prefixLen := 0
+	for node != nil {
+		if n, ok := node.(*HashNode); ok {
+			loadedNode, err := t.resolve(context.Background(), n, key[:prefixLen])
+			if err != nil {
+				return err
+			}
+			node = loadedNode
+		}
+		data := node.Serialize()
+		if !seen[string(node.Hash())] {
+			seen[string(node.Hash())] = true
+			proof.Nodes = append(proof.Nodes, data)
+		}
+		switch n := node.(type) {
+		case *FullNode:
+			if prefixLen == len(key) {
+				node = n.Children[256]
+			} else {
+				node = n.Children[key[prefixLen]]
+				prefixLen++
+			}
+		case *ShortNode:
+			if len(key)-prefixLen < len(n.Key) || !bytes.Equal(n.Key, key[prefixLen:prefixLen+len(n.Key)]) {
+				return nil
+			}
+			node = n.Value
+			prefixLen += len(n.Key)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// VerifyMultiProof checks a proof produced by ProveMany against root and
+// returns the value of every key, or nil for keys proven absent. It fails if
+// the proof lacks a node on the path of any key.
+func VerifyMultiProof(root []byte, keys [][]byte, proof []byte) ([][]byte, error) {
+	persistProof := PersistMultiProof{}
+	err := cbor.Unmarshal(proof, &persistProof)
+	if err != nil {
+		return nil, fmt.Errorf("[Proof] cannot decode proof: %s", err.Error())
+	}
+	nodes := make(map[string][]byte, len(persistProof.Nodes))
+	for _, data := range persistProof.Nodes {
+		hash := crypto.MainHash(data)
+		nodes[string(hash[:])] = data
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], err = verifyProofPath(root, key, nodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func verifyProofPath(root, key []byte, nodes map[string][]byte) ([]byte, error) {
+	hash := root
+	prefixLen := 0
+	for len(hash) > 0 {
+		data, ok := nodes[string(hash)]
+		if !ok {
+			return nil, &ErrMissingNode{
+				Hash: hash,
+				Path: key[:prefixLen],
+				Err:  storage.ErrNotFound,
+			}
+		}
+		node, err := DeserializeNode(data)
+		if err != nil {
+			return nil, err
+		}
+		var child Node
+		switch n := node.(type) {
+		case *FullNode:
+			if prefixLen == len(key) {
+				child = n.Children[256]
+			} else {
+				child = n.Children[key[prefixLen]]
+				prefixLen++
+			}
+		case *ShortNode:
+			if len(key)-prefixLen < len(n.Key) || !bytes.Equal(n.Key, key[prefixLen:prefixLen+len(n.Key)]) {
+				return nil, nil
+			}
+			child = n.Value
+			prefixLen += len(n.Key)
+		case *ValueNode:
+			if prefixLen == len(key) {
+				return append([]byte{}, n.Value...), nil
+			}
+			return nil, nil
+		}
+		if child == nil {
+			return nil, nil
+		}
+		hash = child.Hash()
+	}
+	return nil, nil
+}
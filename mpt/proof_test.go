@@ -0,0 +1,71 @@
+package mpt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+func TestMultiProof(t *testing.T) {
+	trie := New(nil, storage.NewMemoryAdapter())
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		trie.Put(key, key)
+	}
+	trie.Commit()
+	trie.Abort()
+	root := trie.RootHash()
+
+	var keys [][]byte
+	for i := 0; i < 1000; i += 10 {
+		keys = append(keys, []byte(fmt.Sprintf("key-%d", i)))
+	}
+	keys = append(keys, []byte("key-missing"), []byte("key-1000"), []byte("k"))
+	proof, err := trie.ProveMany(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	independent := 0
+	for _, key := range keys {
+		single, err := trie.ProveMany([][]byte{key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		independent += len(single)
+	}
+	if len(proof) >= independent {
+		t.Errorf("Multiproof of %d bytes is not smaller than %d bytes of single proofs", len(proof), independent)
+	}
+
+	values, err := VerifyMultiProof(root, keys, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range keys[:100] {
+		if string(values[i]) != string(key) {
+			t.Errorf("Expected %s, got %s", key, values[i])
+		}
+	}
+	for i := 100; i < len(keys); i++ {
+		if values[i] != nil {
+			t.Errorf("Expected %s to be absent, got %s", keys[i], values[i])
+		}
+	}
+
+	_, err = VerifyMultiProof([]byte("wrong root"), keys, proof)
+	if err == nil {
+		t.Error("Expected error for wrong root")
+	}
+
+	persistProof := PersistMultiProof{}
+	cbor.Unmarshal(proof, &persistProof)
+	persistProof.Nodes = persistProof.Nodes[:len(persistProof.Nodes)-1]
+	truncated, _ := cbor.Marshal(&persistProof)
+	_, err = VerifyMultiProof(root, keys, truncated)
+	if err == nil {
+		t.Error("Expected error for incomplete proof")
+	}
+}
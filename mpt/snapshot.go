@@ -0,0 +1,198 @@
+package mpt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Snapshots are streamed in a binary format made of a header
+//
+//	magic "MPTS" | version (1) | hash algorithm (1) | root hash | key count
+//
+// followed by every key-value pair of the trie in ascending key order. The
+// root hash, keys and values are prefixed with their length and all integers
+// are uvarints.
+const (
+	SnapshotVersion = 1
+
+	// SnapshotHashSHA256 identifies crypto.MainHash in snapshot headers.
+	SnapshotHashSHA256 = 1
+)
+
+var snapshotMagic = []byte("MPTS")
+
+// snapshotHeader is the decoded header of a snapshot.
+type snapshotHeader struct {
+	root  []byte
+	count uint64
+}
+
+// WriteSnapshot streams every key-value pair of the trie to w in the binary
+// snapshot format. Pairs are read from the store as they are written, so the
+// trie does not have to fit in memory; it is walked twice, once to count the
+// keys for the header.
+func (t *Trie) WriteSnapshot(w io.Writer) error {
+	return t.WriteSnapshotContext(context.Background(), w)
+}
+
+func (t *Trie) WriteSnapshotContext(ctx context.Context, w io.Writer) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var count uint64
+	err := t.iterate(ctx, func(key, value []byte) {
+		count++
+	})
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(snapshotMagic)
+	bw.WriteByte(SnapshotVersion)
+	bw.WriteByte(SnapshotHashSHA256)
+	writeSnapshotBytes(bw, t.RootHash())
+	writeSnapshotUvarint(bw, count)
+	// bufio.Writer keeps the first write error, reported by Flush
+	err = t.iterate(ctx, func(key, value []byte) {
+		writeSnapshotBytes(bw, key)
+		writeSnapshotBytes(bw, value)
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeSnapshotUvarint(w *bufio.Writer, n uint64) {
+	w.Write(binary.AppendUvarint(nil, n))
+}
+
+func writeSnapshotBytes(w *bufio.Writer, data []byte) {
+	writeSnapshotUvarint(w, uint64(len(data)))
+	w.Write(data)
+}
+
+// ReadSnapshot replaces the content of the trie with a snapshot written by
+// WriteSnapshot, rebuilding it from empty. If the snapshot cannot be read or
+// the rebuilt root differs from the one it records, the trie is reset to
+// its last committed root with Abort and ErrRootMismatch or
+// ErrInvalidSnapshot is returned. The imported pairs are not committed.
+// The trie is locked during the import, so readers never see it half-built.
+func (t *Trie) ReadSnapshot(r io.Reader) error {
+	if t.readOnly {
+		return ErrReadOnly
+	}
+	br := bufio.NewReader(r)
+	header, err := readSnapshotHeader(br)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.root = nil
+	err = readSnapshotPairs(br, header.count, func(key, value []byte) error {
+		valueNode := ValueNode{value, nil, true}
+		newNode, err := t.put(context.Background(), t.root, key, &valueNode, 0)
+		if newNode != nil {
+			t.root = newNode
+		}
+		return err
+	})
+	if err != nil {
+		t.abort()
+		return err
+	}
+	if root := t.RootHash(); !bytes.Equal(root, header.root) {
+		t.abort()
+		return fmt.Errorf("%w: recorded %x, rebuilt %x", ErrRootMismatch, header.root, root)
+	}
+	return nil
+}
+
+func readSnapshotHeader(r *bufio.Reader) (*snapshotHeader, error) {
+	magic := make([]byte, len(snapshotMagic))
+	_, err := io.ReadFull(r, magic)
+	if err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return nil, fmt.Errorf("%w: not a snapshot", ErrInvalidSnapshot)
+	}
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, snapshotReadError(err)
+	}
+	if version != SnapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, version)
+	}
+	algorithm, err := r.ReadByte()
+	if err != nil {
+		return nil, snapshotReadError(err)
+	}
+	if algorithm != SnapshotHashSHA256 {
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %d", ErrInvalidSnapshot, algorithm)
+	}
+	root, err := readSnapshotBytes(r)
+	if err != nil {
+		return nil, err
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, snapshotReadError(err)
+	}
+	return &snapshotHeader{root, count}, nil
+}
+
+// readSnapshotPairs reads count pairs and passes them to fn, checking that
+// keys are in ascending order and that nothing follows the last pair.
+func readSnapshotPairs(r *bufio.Reader, count uint64, fn func(key, value []byte) error) error {
+	var previous []byte
+	for i := uint64(0); i < count; i++ {
+		key, err := readSnapshotBytes(r)
+		if err != nil {
+			return err
+		}
+		if i > 0 && bytes.Compare(previous, key) >= 0 {
+			return fmt.Errorf("%w: key %x out of order", ErrInvalidSnapshot, key)
+		}
+		value, err := readSnapshotBytes(r)
+		if err != nil {
+			return err
+		}
+		err = fn(key, value)
+		if err != nil {
+			return err
+		}
+		previous = key
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return fmt.Errorf("%w: unexpected data after %d pairs", ErrInvalidSnapshot, count)
+	}
+	return nil
+}
+
+func readSnapshotBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, snapshotReadError(err)
+	}
+	// a limited reader keeps a corrupted length from allocating more than
+	// what is left
+	data, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, snapshotReadError(err)
+	}
+	if uint64(len(data)) != n {
+		return nil, snapshotReadError(io.ErrUnexpectedEOF)
+	}
+	return data, nil
+}
+
+func snapshotReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated", ErrInvalidSnapshot)
+	}
+	return err
+}
@@ -0,0 +1,221 @@
+package mpt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+func TestWriteSnapshot(t *testing.T) {
+	keys := []string{"123456", "134567", "1234567890", "12345678"}
+	trie := New(nil, storage.NewMemoryAdapter())
+	for _, key := range keys {
+		trie.Put([]byte(key), []byte("value-"+key))
+	}
+	trie.Commit()
+	var buf bytes.Buffer
+	err := trie.WriteSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the encoding does not depend on insertion order or on which nodes are
+	// loaded
+	reversed := New(nil, storage.NewMemoryAdapter())
+	for i := len(keys) - 1; i >= 0; i-- {
+		reversed.Put([]byte(keys[i]), []byte("value-"+keys[i]))
+	}
+	var other bytes.Buffer
+	reversed.WriteSnapshot(&other)
+	if !bytes.Equal(buf.Bytes(), other.Bytes()) {
+		t.Error("Snapshots of the same trie differ")
+	}
+
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("MPTS")) || data[4] != SnapshotVersion || data[5] != SnapshotHashSHA256 {
+		t.Fatalf("Unexpected header %x", data[:6])
+	}
+	if data[6] != 32 || !bytes.Equal(data[7:39], trie.RootHash()) {
+		t.Errorf("Expected root %x, got %x", trie.RootHash(), data[7:39])
+	}
+	if data[39] != byte(len(keys)) {
+		t.Errorf("Expected %d keys, got %d", len(keys), data[39])
+	}
+	// pairs follow in key order
+	if data[40] != 6 || string(data[41:47]) != "123456" {
+		t.Errorf("Unexpected first key %q", data[41:47])
+	}
+
+	restored := New(nil, storage.NewMemoryAdapter())
+	err = restored.ReadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored.RootHash(), trie.RootHash()) {
+		t.Error("Restored trie has a different root")
+	}
+}
+
+func TestWriteSnapshotEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	err := New(nil, storage.NewMemoryAdapter()).WriteSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := New(nil, storage.NewMemoryAdapter())
+	err = restored.ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.RootHash() != nil {
+		t.Error("Expected an empty trie")
+	}
+}
+
+func TestReadSnapshotInvalid(t *testing.T) {
+	trie := New(nil, storage.NewMemoryAdapter())
+	trie.Put([]byte("123456"), []byte("A"))
+	trie.Put([]byte("134567"), []byte("B"))
+	var buf bytes.Buffer
+	trie.WriteSnapshot(&buf)
+	data := buf.Bytes()
+
+	swapped := append([]byte{}, data...)
+	// both pairs are 1+6+1+1 bytes long and end the snapshot
+	end := len(swapped)
+	copy(swapped[end-18:], data[end-9:])
+	copy(swapped[end-9:], data[end-18:end-9])
+
+	cases := map[string][]byte{
+		"magic":     append([]byte("JSON"), data[4:]...),
+		"version":   append(append(append([]byte{}, data[:4]...), 2), data[5:]...),
+		"algorithm": append(append(append([]byte{}, data[:5]...), 9), data[6:]...),
+		"truncated": data[:len(data)-3],
+		"trailing":  append(append([]byte{}, data...), 0),
+		"order":     swapped,
+	}
+	for name, input := range cases {
+		err := New(nil, storage.NewMemoryAdapter()).ReadSnapshot(bytes.NewReader(input))
+		if !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf("%s: expected ErrInvalidSnapshot, got %v", name, err)
+		}
+	}
+}
+
+func TestReadSnapshotRootMismatch(t *testing.T) {
+	source := New(nil, storage.NewMemoryAdapter())
+	source.Put([]byte("123456"), []byte("A"))
+	source.Put([]byte("134567"), []byte("B"))
+	var buf bytes.Buffer
+	source.WriteSnapshot(&buf)
+	data := buf.Bytes()
+
+	trie := New(nil, storage.NewMemoryAdapter())
+	trie.Put([]byte("999999"), []byte("Z"))
+	trie.Commit()
+	committedRoot := trie.RootHash()
+	trie.Put([]byte("888888"), []byte("Y"))
+
+	// the value of the last pair is the last byte
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] = 'C'
+	err := trie.ReadSnapshot(bytes.NewReader(tampered))
+	if !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("Expected ErrRootMismatch, got %v", err)
+	}
+	if !bytes.Equal(trie.RootHash(), committedRoot) {
+		t.Error("Failed import was not rolled back")
+	}
+	if _, err := trie.Get([]byte("134567")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	err = trie.ReadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(trie.RootHash(), source.RootHash()) {
+		t.Error("Import did not rebuild the snapshot root")
+	}
+	if _, err := trie.Get([]byte("999999")); !errors.Is(err, ErrNotFound) {
+		t.Error("Import did not start from an empty trie")
+	}
+}
+
+// pausingReader blocks once half of its data is read until resume is closed.
+type pausingReader struct {
+	data   []byte
+	read   int
+	paused chan struct{}
+	resume chan struct{}
+}
+
+func (r *pausingReader) Read(p []byte) (int, error) {
+	if r.read == len(r.data)/2 {
+		close(r.paused)
+		<-r.resume
+	}
+	if r.read == len(r.data) {
+		return 0, io.EOF
+	}
+	end := r.read + len(p)
+	if r.read < len(r.data)/2 && end > len(r.data)/2 {
+		end = len(r.data) / 2
+	} else if end > len(r.data) {
+		end = len(r.data)
+	}
+	n := copy(p, r.data[r.read:end])
+	r.read += n
+	return n, nil
+}
+
+func TestReadSnapshotConcurrentGet(t *testing.T) {
+	source := New(nil, storage.NewMemoryAdapter())
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%03d", i))
+		source.Put(key, key)
+	}
+	var buf bytes.Buffer
+	source.WriteSnapshot(&buf)
+
+	// the key read concurrently is the last one imported
+	trie := New(nil, storage.NewMemoryAdapter())
+	trie.Put([]byte("key-099"), []byte("old"))
+	trie.Commit()
+
+	r := &pausingReader{data: buf.Bytes(), paused: make(chan struct{}), resume: make(chan struct{})}
+	imported := make(chan error, 1)
+	go func() {
+		imported <- trie.ReadSnapshot(r)
+	}()
+	<-r.paused
+
+	got := make(chan error, 1)
+	go func() {
+		value, err := trie.Get([]byte("key-099"))
+		if err == nil && string(value) != "key-099" {
+			err = fmt.Errorf("got %q", value)
+		}
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		t.Errorf("Expected Get to wait for the import, got %v", err)
+		close(r.resume)
+		<-imported
+		return
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(r.resume)
+	if err := <-imported; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-got; err != nil {
+		t.Errorf("Expected the imported value, got %v", err)
+	}
+}
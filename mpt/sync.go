@@ -0,0 +1,143 @@
+package mpt
+
+import (
+	"fmt"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+const DefaultSyncBatchSize = 128
+
+// NodeFetcher retrieves serialized nodes by hash from a remote peer. The
+// returned slice must have one entry per requested hash, in request order.
+type NodeFetcher interface {
+	FetchNodes(hashes [][]byte) ([][]byte, error)
+}
+
+type sourceFetcher struct {
+	source NodeSource
+}
+
+// NewSourceFetcher returns a NodeFetcher serving nodes from a NodeSource,
+// such as the StorageAdapter of an in-process trie.
+func NewSourceFetcher(source NodeSource) NodeFetcher {
+	return &sourceFetcher{source}
+}
+
+func (f *sourceFetcher) FetchNodes(hashes [][]byte) ([][]byte, error) {
+	nodes := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		data, err := f.source.Get(hash)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = data
+	}
+	return nodes, nil
+}
+
+// Syncer downloads the trie with a given root hash into a local store.
+//
+// Nodes are requested in batches, verified against their hash and persisted
+// before their children are scheduled. Sync can be called again after an
+// error or a restart: nodes already present in the local store are walked
+// instead of fetched, so only the missing part of the trie is downloaded.
+type Syncer struct {
+	root      []byte
+	store     storage.StorageAdapter
+	fetcher   NodeFetcher
+	batchSize int
+	fetched   int
+}
+
+func NewSyncer(root []byte, store storage.StorageAdapter, fetcher NodeFetcher) *Syncer {
+	return &Syncer{
+		root:      root,
+		store:     store,
+		fetcher:   fetcher,
+		batchSize: DefaultSyncBatchSize,
+	}
+}
+
+// SetBatchSize sets the maximum number of hashes requested at once.
+func (s *Syncer) SetBatchSize(size int) {
+	if size > 0 {
+		s.batchSize = size
+	}
+}
+
+// Fetched returns the number of nodes downloaded by this Syncer so far.
+func (s *Syncer) Fetched() int {
+	return s.fetched
+}
+
+func (s *Syncer) Sync() error {
+	if len(s.root) == 0 {
+		return nil
+	}
+	visited := make(map[string]bool)
+	pending := [][]byte{s.root}
+	var batch [][]byte
+	for len(pending) > 0 || len(batch) > 0 {
+		if len(pending) > 0 {
+			hash := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if visited[string(hash)] {
+				continue
+			}
+			visited[string(hash)] = true
+
+			data, err := s.store.Get(hash)
+			if err == nil && verifyHash(hash, data) {
+				node, err := DeserializeNode(data)
+				if err != nil {
+					return err
+				}
+				pending = append(pending, childHashes(node)...)
+				continue
+			}
+			batch = append(batch, hash)
+			if len(batch) < s.batchSize && len(pending) > 0 {
+				continue
+			}
+		}
+		children, err := s.fetch(batch)
+		if err != nil {
+			return err
+		}
+		batch = batch[:0]
+		pending = append(pending, children...)
+	}
+	return nil
+}
+
+// fetch downloads, verifies and persists a batch of nodes and returns the
+// hashes of their children.
+func (s *Syncer) fetch(hashes [][]byte) ([][]byte, error) {
+	nodes, err := s.fetcher.FetchNodes(hashes)
+	if err != nil {
+		return nil, fmt.Errorf("[Syncer] cannot fetch nodes: %w", err)
+	}
+	if len(nodes) != len(hashes) {
+		return nil, fmt.Errorf("[Syncer] requested %d nodes, got %d", len(hashes), len(nodes))
+	}
+	var children [][]byte
+	kvs := make([][2][]byte, len(hashes))
+	for i, data := range nodes {
+		if !verifyHash(hashes[i], data) {
+			return nil, hashMismatchError(hashes[i])
+		}
+		node, err := DeserializeNode(data)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, childHashes(node)...)
+		kvs[i] = [2][]byte{hashes[i], data}
+	}
+	err = s.store.BatchPut(kvs)
+	if err != nil {
+		return nil, err
+	}
+	s.fetched += len(nodes)
+	return children, nil
+}
@@ -0,0 +1,95 @@
+package mpt
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+type flakyFetcher struct {
+	NodeFetcher
+	calls     int
+	failAfter int
+	maxBatch  int
+}
+
+func (f *flakyFetcher) FetchNodes(hashes [][]byte) ([][]byte, error) {
+	f.calls++
+	if len(hashes) > f.maxBatch {
+		f.maxBatch = len(hashes)
+	}
+	if f.failAfter > 0 && f.calls > f.failAfter {
+		return nil, errors.New("connection reset")
+	}
+	return f.NodeFetcher.FetchNodes(hashes)
+}
+
+func TestSyncResume(t *testing.T) {
+	remote := storage.NewMemoryAdapter()
+	trie := New(nil, remote)
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		err := trie.Put(key, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	trie.Commit()
+	root := trie.RootHash()
+	total := len(trie.CreateSnapshot())
+
+	local := storage.NewMemoryAdapter()
+	fetcher := &flakyFetcher{NodeFetcher: NewSourceFetcher(remote), failAfter: 2}
+	syncer := NewSyncer(root, local, fetcher)
+	syncer.SetBatchSize(16)
+	err := syncer.Sync()
+	if err == nil {
+		t.Fatal("Expected sync to be interrupted")
+	}
+	interrupted := syncer.Fetched()
+	if interrupted == 0 || interrupted >= total {
+		t.Fatalf("Expected partial sync, got %d of %d nodes", interrupted, total)
+	}
+	if fetcher.maxBatch > 16 {
+		t.Errorf("Expected batches of at most 16 nodes, got %d", fetcher.maxBatch)
+	}
+
+	syncer = NewSyncer(root, local, NewSourceFetcher(remote))
+	err = syncer.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted+syncer.Fetched() != total {
+		t.Errorf("Expected %d nodes in total, got %d + %d", total, interrupted, syncer.Fetched())
+	}
+
+	rootNode := HashNode(root)
+	trie = New(&rootNode, local)
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		value, err := trie.Get(key)
+		if err != nil || string(value) != string(key) {
+			t.Errorf("Expected %s, got %s (err: %v)", key, value, err)
+		}
+	}
+}
+
+func TestSyncRejectsBadNode(t *testing.T) {
+	remote := storage.NewMemoryAdapter()
+	trie := New(nil, remote)
+	trie.Put([]byte("123456"), []byte("A"))
+	trie.Commit()
+	root := trie.RootHash()
+	remote.Put(root, []byte("garbage"))
+
+	local := storage.NewMemoryAdapter()
+	err := NewSyncer(root, local, NewSourceFetcher(remote)).Sync()
+	if err == nil {
+		t.Error("Expected hash mismatch error")
+	}
+	if local.Has(root) {
+		t.Error("Unverified node was written to the store")
+	}
+}
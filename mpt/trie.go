@@ -2,7 +2,7 @@ package mpt
 
 import (
 	"bytes"
-	"encoding/hex"
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -12,10 +12,12 @@ import (
 )
 
 type Trie struct {
-	oldRoot []byte
-	root    Node
-	store   storage.StorageAdapter
-	lock    *sync.RWMutex
+	oldRoot  []byte
+	root     Node
+	store    storage.StorageAdapter
+	lock     *sync.RWMutex
+	witness  Witness
+	readOnly bool
 }
 
 func New(root Node, store storage.StorageAdapter) *Trie {
@@ -32,10 +34,30 @@ func New(root Node, store storage.StorageAdapter) *Trie {
 	}
 }
 
+// OpenReadOnly returns a trie with the given root that can only be read. Put,
+// Delete, Commit and Deserialize fail with ErrReadOnly without touching the
+// trie, and the store is wrapped so that it is never written.
+func OpenReadOnly(root []byte, store storage.StorageAdapter) *Trie {
+	var rootNode Node
+	if len(root) > 0 {
+		hashNode := HashNode(root)
+		rootNode = &hashNode
+	}
+	t := New(rootNode, storage.ReadOnly(store))
+	t.readOnly = true
+	return t
+}
+
 func (t *Trie) Get(key []byte) ([]byte, error) {
+	return t.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get but aborts when ctx is done while nodes are loaded
+// from the store.
+func (t *Trie) GetContext(ctx context.Context, key []byte) ([]byte, error) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
-	node, expandedNode, err := t.get(t.root, key, 0)
+	node, expandedNode, err := t.get(ctx, t.root, key, 0)
 	if expandedNode != nil {
 		t.root = expandedNode
 	}
@@ -44,74 +66,74 @@ func (t *Trie) Get(key []byte) ([]byte, error) {
 	} else if v, ok := node.(*ValueNode); ok {
 		return []byte(v.Value), nil
 	} else {
-		return nil, errors.New(fmt.Sprintf("[Trie] key not found: %s", hex.EncodeToString(key)))
+		return nil, notFoundError(key)
 	}
 }
 
-func (t *Trie) get(node Node, key []byte, prefixLen int) (Node, Node, error) {
+func (t *Trie) get(ctx context.Context, node Node, key []byte, prefixLen int) (Node, Node, error) {
 	if node == nil {
-		return nil, node, errors.New(fmt.Sprintf("[Trie] key not found: %s", hex.EncodeToString(key)))
+		return nil, node, notFoundError(key)
 	}
 	switch n := node.(type) {
 	case *FullNode:
 		if prefixLen > len(key) {
-			return nil, node, errors.New(fmt.Sprintf("[Trie] key not found: %s", hex.EncodeToString(key)))
+			return nil, node, notFoundError(key)
 		}
 		if prefixLen == len(key) {
-			valueNode, newNode, err := t.get(n.Children[256], key, prefixLen)
+			valueNode, newNode, err := t.get(ctx, n.Children[256], key, prefixLen)
 			n.Children[256] = newNode
 			return valueNode, node, err
 		} else {
-			valueNode, newNode, err := t.get(n.Children[key[prefixLen]], key, prefixLen+1)
+			valueNode, newNode, err := t.get(ctx, n.Children[key[prefixLen]], key, prefixLen+1)
 			n.Children[key[prefixLen]] = newNode
 			return valueNode, node, err
 		}
 	case *ShortNode:
 		if len(key)-prefixLen < len(n.Key) || !bytes.Equal(n.Key, key[prefixLen:prefixLen+len(n.Key)]) {
-			return nil, node, errors.New(fmt.Sprintf("[Trie] key not found: %s", hex.EncodeToString(key)))
+			return nil, node, notFoundError(key)
 		}
-		valueNode, newNode, err := t.get(n.Value, key, prefixLen+len(n.Key))
+		valueNode, newNode, err := t.get(ctx, n.Value, key, prefixLen+len(n.Key))
 		n.Value = newNode
 		return valueNode, node, err
 	case *HashNode:
-		data, err := t.store.Get([]byte(*n))
+		loadedNode, err := t.resolve(ctx, n, key[:prefixLen])
 		if err != nil {
 			return nil, node, err
 		}
-		loadedNode, err := DeserializeNode(data)
-		if err != nil {
-			return nil, node, errors.New(fmt.Sprintf("[Trie] Cannot load node: %s", err.Error()))
-		}
-		if !bytes.Equal([]byte(*n), loadedNode.Hash()) {
-			return nil, node, errors.New(fmt.Sprintf("[Trie] Cannot load node: hash does not match"))
-		}
-		valueNode, loadedNode, err := t.get(loadedNode, key, prefixLen)
+		valueNode, loadedNode, err := t.get(ctx, loadedNode, key, prefixLen)
 		return valueNode, loadedNode, err
 	case *ValueNode:
 		if prefixLen == len(key) {
 			return node, node, nil
 		} else {
-			return nil, node, errors.New(fmt.Sprintf("[Trie] key not found: %s", hex.EncodeToString(key)))
+			return nil, node, notFoundError(key)
 		}
 	}
 	return nil, node, errors.New("[Tire] Unknown node type")
 }
 
 func (t *Trie) Put(key, value []byte) error {
+	return t.PutContext(context.Background(), key, value)
+}
+
+func (t *Trie) PutContext(ctx context.Context, key, value []byte) error {
+	if t.readOnly {
+		return ErrReadOnly
+	}
 	t.lock.Lock()
 	defer t.lock.Unlock()
 	valueNode := ValueNode{value, nil, true}
-	expandedNode, err := t.put(t.root, key, &valueNode, 0)
+	expandedNode, err := t.put(ctx, t.root, key, &valueNode, 0)
 	if expandedNode != nil {
 		t.root = expandedNode
 	}
 	return err
 }
 
-func (t *Trie) put(node Node, key []byte, value Node, prefixLen int) (Node, error) {
+func (t *Trie) put(ctx context.Context, node Node, key []byte, value Node, prefixLen int) (Node, error) {
 	if node == nil {
 		if prefixLen > len(key) {
-			return node, errors.New("[Trie] Cannot insert")
+			return node, invalidKeyError(key)
 		} else if prefixLen == len(key) {
 			return value, nil
 		} else {
@@ -127,13 +149,13 @@ func (t *Trie) put(node Node, key []byte, value Node, prefixLen int) (Node, erro
 	case *FullNode:
 		n.dirty = true
 		if prefixLen > len(key) {
-			return node, errors.New(fmt.Sprintf("[Trie] Cannot insert"))
+			return node, invalidKeyError(key)
 		} else if prefixLen == len(key) {
 			n.Children[256] = value
 			return n, nil
 		}
 		// prefixLen < len(key)
-		newNode, err := t.put(n.Children[key[prefixLen]], key, value, prefixLen+1)
+		newNode, err := t.put(ctx, n.Children[key[prefixLen]], key, value, prefixLen+1)
 		if err != nil {
 			return node, err
 		}
@@ -142,11 +164,11 @@ func (t *Trie) put(node Node, key []byte, value Node, prefixLen int) (Node, erro
 	case *ShortNode:
 		n.dirty = true
 		if prefixLen > len(key) {
-			return node, errors.New(fmt.Sprintf("[Trie] Cannot insert"))
+			return node, invalidKeyError(key)
 		}
 		commonLen := commonPrefix(n.Key, key[prefixLen:])
 		if commonLen == len(n.Key) {
-			newNode, err := t.put(n.Value, key, value, prefixLen+len(n.Key))
+			newNode, err := t.put(ctx, n.Value, key, value, prefixLen+len(n.Key))
 			if err != nil {
 				return node, err
 			}
@@ -155,11 +177,11 @@ func (t *Trie) put(node Node, key []byte, value Node, prefixLen int) (Node, erro
 		}
 		prefixLen += commonLen
 		fullNode := &FullNode{dirty: true}
-		newNode, err := t.put(fullNode, key, value, prefixLen)
+		newNode, err := t.put(ctx, fullNode, key, value, prefixLen)
 		if err != nil {
 			return node, err
 		}
-		newNode, err = t.put(newNode, n.Key, n.Value, commonLen)
+		newNode, err = t.put(ctx, newNode, n.Key, n.Value, commonLen)
 		if err != nil {
 			return node, err
 		}
@@ -177,37 +199,149 @@ func (t *Trie) put(node Node, key []byte, value Node, prefixLen int) (Node, erro
 			return value, nil
 		} else if prefixLen < len(key) {
 			fullNode := &FullNode{dirty: true}
-			newNode, err := t.put(fullNode, key, value, prefixLen)
+			newNode, err := t.put(ctx, fullNode, key, value, prefixLen)
 			if err != nil {
-				return node, errors.New(fmt.Sprintf("[Trie] Cannot insert"))
+				return node, invalidKeyError(key)
 			}
-			newNode, err = t.put(newNode, key[:prefixLen], node, prefixLen)
+			newNode, err = t.put(ctx, newNode, key[:prefixLen], node, prefixLen)
 			if err != nil {
-				return node, errors.New(fmt.Sprintf("[Trie] Cannot insert"))
+				return node, invalidKeyError(key)
 			}
 			return newNode, nil
 		} else {
-			return node, errors.New(fmt.Sprintf("[Trie] Cannot insert"))
+			return node, invalidKeyError(key)
 		}
 	case *HashNode:
-		if prefixLen >= len(key) {
-			return node, errors.New(fmt.Sprintf("[Trie] Cannot insert"))
+		newNode, err := t.resolve(ctx, n, key[:prefixLen])
+		if err != nil {
+			return node, err
+		}
+		newNode, err = t.put(ctx, newNode, key, value, prefixLen)
+		if err != nil {
+			return node, err
+		}
+		return newNode, nil
+	}
+	return node, invalidKeyError(key)
+}
+
+func (t *Trie) Delete(key []byte) error {
+	return t.DeleteContext(context.Background(), key)
+}
+
+func (t *Trie) DeleteContext(ctx context.Context, key []byte) error {
+	if t.readOnly {
+		return ErrReadOnly
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	newNode, err := t.delete(ctx, t.root, key, 0)
+	if err != nil {
+		return err
+	}
+	t.root = newNode
+	return nil
+}
+
+func (t *Trie) delete(ctx context.Context, node Node, key []byte, prefixLen int) (Node, error) {
+	if node == nil {
+		return nil, notFoundError(key)
+	}
+	switch n := node.(type) {
+	case *FullNode:
+		path := key[:prefixLen]
+		index := 256
+		if prefixLen < len(key) {
+			index = int(key[prefixLen])
+			prefixLen++
+		}
+		newNode, err := t.delete(ctx, n.Children[index], key, prefixLen)
+		if err != nil {
+			return node, err
 		}
-		data, err := t.store.Get([]byte(*n))
+		// nodes are copied rather than changed, so that a failed delete, for
+		// instance when collapse cannot resolve a sibling, leaves the trie
+		// as it was
+		copied := &FullNode{Children: n.Children, dirty: true}
+		copied.Children[index] = newNode
+		collapsed, err := t.collapse(ctx, copied, path)
 		if err != nil {
 			return node, err
 		}
-		newNode, err := DeserializeNode(data)
+		return collapsed, nil
+	case *ShortNode:
+		if len(key)-prefixLen < len(n.Key) || !bytes.Equal(n.Key, key[prefixLen:prefixLen+len(n.Key)]) {
+			return node, notFoundError(key)
+		}
+		newNode, err := t.delete(ctx, n.Value, key, prefixLen+len(n.Key))
 		if err != nil {
 			return node, err
 		}
-		newNode, err = t.put(newNode, key, value, prefixLen)
+		switch child := newNode.(type) {
+		case nil:
+			return nil, nil
+		case *ShortNode:
+			return &ShortNode{
+				Key:   append(append([]byte{}, n.Key...), child.Key...),
+				Value: child.Value,
+				dirty: true,
+			}, nil
+		}
+		return &ShortNode{Key: n.Key, Value: newNode, dirty: true}, nil
+	case *ValueNode:
+		if prefixLen == len(key) {
+			return nil, nil
+		}
+		return node, notFoundError(key)
+	case *HashNode:
+		loadedNode, err := t.resolve(ctx, n, key[:prefixLen])
 		if err != nil {
 			return node, err
 		}
-		return newNode, nil
+		return t.delete(ctx, loadedNode, key, prefixLen)
+	}
+	return node, errors.New("[Trie] Unknown node type")
+}
+
+// collapse replaces a full node left with a single child by the equivalent
+// short or value node, so that the trie shape does not depend on the order
+// of operations.
+func (t *Trie) collapse(ctx context.Context, n *FullNode, path []byte) (Node, error) {
+	index := -1
+	for i := 0; i < len(n.Children); i++ {
+		if n.Children[i] != nil {
+			if index >= 0 {
+				return n, nil
+			}
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, nil
 	}
-	return node, errors.New(fmt.Sprintf("[Trie] Cannot insert"))
+	if index == 256 {
+		return n.Children[256], nil
+	}
+	child := n.Children[index]
+	if hashNode, ok := child.(*HashNode); ok {
+		loadedNode, err := t.resolve(ctx, hashNode, append(append([]byte{}, path...), byte(index)))
+		if err != nil {
+			return n, err
+		}
+		child = loadedNode
+	}
+	if shortNode, ok := child.(*ShortNode); ok {
+		return &ShortNode{
+			Key:   append([]byte{byte(index)}, shortNode.Key...),
+			Value: shortNode.Value,
+			dirty: true,
+		}, nil
+	}
+	return &ShortNode{
+		Key:   []byte{byte(index)},
+		Value: child,
+		dirty: true,
+	}, nil
 }
 
 func commonPrefix(a, b []byte) int {
@@ -226,34 +360,71 @@ func commonPrefix(a, b []byte) int {
 	return ret
 }
 
-func (t *Trie) Commit() {
+func (t *Trie) Commit() error {
+	return t.CommitContext(context.Background())
+}
+
+// CommitContext persists all nodes of the trie in a single batch. If ctx is
+// done before the batch is written, nothing is persisted and the last
+// committed root is kept.
+func (t *Trie) CommitContext(ctx context.Context) error {
+	if t.readOnly {
+		return ErrReadOnly
+	}
 	t.lock.Lock()
 	defer t.lock.Unlock()
 	if t.root == nil {
-		return
+		return nil
+	}
+	batch := storage.NewBatch(t.store)
+	err := t.commit(ctx, t.root, batch)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err = batch.Write()
+	if err != nil {
+		return err
 	}
-	t.commit(t.root)
 	t.oldRoot = t.root.CachedHash()
+	return nil
 }
 
-func (t *Trie) commit(node Node) {
+func (t *Trie) commit(ctx context.Context, node Node, batch storage.Batch) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	switch n := node.(type) {
 	case *FullNode:
 		for i := 0; i < len(n.Children); i++ {
-			t.commit(n.Children[i])
+			err := t.commit(ctx, n.Children[i], batch)
+			if err != nil {
+				return err
+			}
 		}
-		n.Save(t.store)
 	case *ShortNode:
-		t.commit(n.Value)
-		n.Save(t.store)
+		err := t.commit(ctx, n.Value, batch)
+		if err != nil {
+			return err
+		}
 	case *ValueNode:
-		n.Save(t.store)
+	default:
+		return nil
 	}
+	data := node.Serialize()
+	return batch.Put(node.CachedHash(), data)
 }
 
 func (t *Trie) Abort() {
 	t.lock.Lock()
 	defer t.lock.Unlock()
+	t.abort()
+}
+
+// abort resets the trie to its last committed root. The lock must be held.
+func (t *Trie) abort() {
 	if t.oldRoot == nil {
 		t.root = nil
 	} else {
@@ -262,6 +433,32 @@ func (t *Trie) Abort() {
 	}
 }
 
+// resolve loads the node referenced by a hash node from the store. path is
+// the key prefix leading to the node, used for error reporting.
+func (t *Trie) resolve(ctx context.Context, n *HashNode, path []byte) (Node, error) {
+	data, err := storage.GetContext(ctx, t.store, []byte(*n))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, &ErrMissingNode{
+			Hash: []byte(*n),
+			Path: append([]byte{}, path...),
+			Err:  err,
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("[Trie] Cannot load node %x: %w", []byte(*n), err)
+	}
+	if !verifyHash([]byte(*n), data) {
+		return nil, hashMismatchError([]byte(*n))
+	}
+	loadedNode, err := DeserializeNode(data)
+	if err != nil {
+		return nil, fmt.Errorf("[Trie] Cannot load node %x: %w", []byte(*n), err)
+	}
+	if t.witness != nil {
+		t.witness[string(*n)] = data
+	}
+	return loadedNode, nil
+}
+
 func (t *Trie) RootHash() []byte {
 	if t.root == nil {
 		return nil
@@ -270,10 +467,14 @@ func (t *Trie) RootHash() []byte {
 }
 
 func (t *Trie) Serialize() ([]byte, error) {
+	return t.SerializeContext(context.Background())
+}
+
+func (t *Trie) SerializeContext(ctx context.Context) ([]byte, error) {
 	t.lock.Lock()
-	t.lock.Unlock()
+	defer t.lock.Unlock()
 	persistTrie := &PersistTrie{}
-	newNode, err := t.persist(t.root, persistTrie)
+	newNode, err := t.persist(ctx, t.root, persistTrie)
 	if err != nil {
 		return nil, err
 	}
@@ -282,14 +483,10 @@ func (t *Trie) Serialize() ([]byte, error) {
 	return data, err
 }
 
-func (t *Trie) persist(node Node, persistTrie *PersistTrie) (Node, error) {
+func (t *Trie) persist(ctx context.Context, node Node, persistTrie *PersistTrie) (Node, error) {
 	if node != nil {
 		if n, ok := node.(*HashNode); ok {
-			data, err := t.store.Get([]byte(*n))
-			if err != nil {
-				return node, err
-			}
-			newNode, err := DeserializeNode(data)
+			newNode, err := t.resolve(ctx, n, nil)
 			if err != nil {
 				return node, err
 			}
@@ -305,15 +502,24 @@ func (t *Trie) persist(node Node, persistTrie *PersistTrie) (Node, error) {
 	switch n := node.(type) {
 	case *FullNode:
 		for i := 0; i < len(n.Children); i++ {
-			t.persist(n.Children[i], persistTrie)
+			_, err := t.persist(ctx, n.Children[i], persistTrie)
+			if err != nil {
+				return node, err
+			}
 		}
 	case *ShortNode:
-		t.persist(n.Value, persistTrie)
+		_, err := t.persist(ctx, n.Value, persistTrie)
+		if err != nil {
+			return node, err
+		}
 	}
 	return node, nil
 }
 
 func (t *Trie) Deserialize(data []byte) error {
+	if t.readOnly {
+		return ErrReadOnly
+	}
 	persistTrie := PersistTrie{}
 	err := cbor.Unmarshal(data, &persistTrie)
 	if err != nil {
@@ -2,12 +2,16 @@ package mpt
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	fmt "fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/vldmkr/merkle-patricia-trie/crypto"
 	"github.com/vldmkr/merkle-patricia-trie/storage"
 )
 
@@ -530,7 +534,7 @@ func TestExportImportSnapshot(t *testing.T) {
 	}
 
 	// Export the snapshot
-	filename := "snapshot_test.json"
+	filename := "snapshot_test.mpts"
 	err = trie.ExportSnapshot(filename)
 	if err != nil {
 		t.Fatalf("Failed to export snapshot: %v", err)
@@ -634,4 +638,420 @@ func getFilenames(files []os.DirEntry) []string {
         filenames = append(filenames, file.Name())
     }
     return filenames
-}
\ No newline at end of file
+}
+func TestDelete(t *testing.T) {
+	keys := []string{"123456", "134567", "123467", "234567", "1234567890", "12345678", "1", "12"}
+	for _, deleted := range [][]string{
+		{"1234567890"},
+		{"12345678", "1234567890"},
+		{"1", "12", "123456"},
+		{"234567", "134567"},
+		keys,
+	} {
+		store := storage.NewMemoryAdapter()
+		trie := New(nil, store)
+		for _, key := range keys {
+			trie.Put([]byte(key), []byte(key))
+		}
+		trie.Commit()
+		trie.Abort()
+
+		expected := New(nil, storage.NewMemoryAdapter())
+		isDeleted := make(map[string]bool)
+		for _, key := range deleted {
+			isDeleted[key] = true
+			err := trie.Delete([]byte(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, key := range keys {
+			if !isDeleted[key] {
+				expected.Put([]byte(key), []byte(key))
+			}
+		}
+		if !bytes.Equal(trie.RootHash(), expected.RootHash()) {
+			t.Errorf("Root after deleting %v does not match a fresh trie", deleted)
+		}
+		for _, key := range keys {
+			value, err := trie.Get([]byte(key))
+			if isDeleted[key] && err == nil {
+				t.Errorf("key %s still present after delete", key)
+			}
+			if !isDeleted[key] && string(value) != key {
+				t.Errorf("key %s wrong after delete (err: %v)", key, err)
+			}
+		}
+	}
+
+	trie := New(nil, storage.NewMemoryAdapter())
+	trie.Put([]byte("123456"), []byte("A"))
+	if trie.Delete([]byte("1234")) == nil {
+		t.Error("Expected error deleting missing key")
+	}
+}
+
+func TestPutExistingAfterReload(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	trie.Put([]byte("ab"), []byte("A"))
+	trie.Put([]byte("ac"), []byte("B"))
+	trie.Commit()
+	trie.Abort()
+	err := trie.Put([]byte("ab"), []byte("C"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := trie.Get([]byte("ab"))
+	if err != nil || string(data) != "C" {
+		t.Errorf("Expected C, got %s (err: %v)", data, err)
+	}
+}
+
+func TestDeleteMissingSibling(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	trie.Put([]byte("ax"), []byte("A"))
+	trie.Put([]byte("ay"), []byte("B"))
+	trie.Commit()
+	root := trie.RootHash()
+
+	rootNode := HashNode(root)
+	trie = New(&rootNode, store)
+	_, err := trie.Get([]byte("ax"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sibling of "ax" is the only node left unloaded
+	var sibling []byte
+	var find func(node Node)
+	find = func(node Node) {
+		switch n := node.(type) {
+		case *FullNode:
+			for _, child := range n.Children {
+				find(child)
+			}
+		case *ShortNode:
+			find(n.Value)
+		case *HashNode:
+			sibling = []byte(*n)
+		}
+	}
+	find(trie.root)
+	if sibling == nil {
+		t.Fatal("Expected an unloaded sibling")
+	}
+	store.Delete(sibling)
+
+	err = trie.Delete([]byte("ax"))
+	var missing *ErrMissingNode
+	if !errors.As(err, &missing) {
+		t.Errorf("Expected ErrMissingNode, got %v", err)
+	}
+	data, err := trie.Get([]byte("ax"))
+	if err != nil || string(data) != "A" {
+		t.Errorf("Expected A after the failed Delete, got %s (err: %v)", data, err)
+	}
+	if !bytes.Equal(trie.RootHash(), root) {
+		t.Error("Failed Delete changed the root hash")
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	trie.Put([]byte("123456"), []byte("A"))
+	trie.Put([]byte("134567"), []byte("B"))
+	trie.Commit()
+	root := trie.RootHash()
+
+	_, err := trie.Get([]byte("999999"))
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	err = trie.Delete([]byte("999999"))
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	data, _ := store.Get(root)
+	store.Delete(root)
+	trie.Abort()
+	_, err = trie.Get([]byte("123456"))
+	var missing *ErrMissingNode
+	if !errors.As(err, &missing) || !bytes.Equal(missing.Hash, root) || len(missing.Path) != 0 {
+		t.Errorf("Expected ErrMissingNode for root, got %v", err)
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrMissingNode to wrap storage.ErrNotFound, got %v", err)
+	}
+
+	data[len(data)-1] ^= 1
+	store.Put(root, data)
+	trie.Abort()
+	_, err = trie.Get([]byte("123456"))
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch, got %v", err)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	trie.Put([]byte("123456"), []byte("A"))
+	err := trie.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := trie.RootHash()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	trie.Put([]byte("134567"), []byte("B"))
+	err = trie.CommitContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	trie.Abort()
+	if !bytes.Equal(trie.RootHash(), root) {
+		t.Error("Cancelled commit changed the committed root")
+	}
+	_, err = trie.GetContext(ctx, []byte("123456"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	err = trie.IterateContext(ctx, func(key, value []byte) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	_, err = trie.SerializeContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestIterateOrder(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	keys := []string{"1", "12", "123456", "12345678", "1234567890", "123467", "134567", "234567"}
+	for i := len(keys) - 1; i >= 0; i-- {
+		trie.Put([]byte(keys[i]), []byte(keys[i]))
+	}
+	trie.Commit()
+	trie.Abort()
+
+	var iterated []string
+	err := trie.IterateContext(context.Background(), func(key, value []byte) {
+		if string(key) != string(value) {
+			t.Errorf("key %s has value %s", key, value)
+		}
+		iterated = append(iterated, string(key))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(iterated) != fmt.Sprint(keys) {
+		t.Errorf("Expected %v, got %v", keys, iterated)
+	}
+}
+
+func TestSpeculativeCommit(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	trie.Put([]byte("123456"), []byte("A"))
+	trie.Commit()
+	rootNode := HashNode(trie.RootHash())
+
+	overlay := storage.NewOverlayAdapter(store)
+	speculative := New(&rootNode, overlay)
+	speculative.Put([]byte("134567"), []byte("B"))
+	err := speculative.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRoot := speculative.RootHash()
+	if store.Has(newRoot) {
+		t.Error("Speculative commit reached the parent store")
+	}
+	overlay.Discard()
+	if _, err := New(&rootNode, store).Get([]byte("134567")); err == nil {
+		t.Error("Discarded write is visible")
+	}
+
+	speculative = New(&rootNode, overlay)
+	speculative.Put([]byte("134567"), []byte("B"))
+	speculative.Commit()
+	err = overlay.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flushedRoot := HashNode(newRoot)
+	data, err := New(&flushedRoot, store).Get([]byte("134567"))
+	if err != nil || string(data) != "B" {
+		t.Errorf("Expected B after Flush, got %s (err: %v)", data, err)
+	}
+}
+
+func TestCompressedStore(t *testing.T) {
+	document := []byte(`{"name":"value","list":[1,2,3],"nested":{"name":"value","list":[1,2,3]}}`)
+	plain := New(nil, storage.NewMemoryAdapter())
+	store, err := storage.NewCompressedAdapter(storage.NewMemoryAdapter(), storage.CompressionZstd, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := New(nil, store)
+	for _, key := range []string{"123456", "134567", "123467"} {
+		plain.Put([]byte(key), document)
+		compressed.Put([]byte(key), document)
+	}
+	compressed.Commit()
+	compressed.Abort()
+	if !bytes.Equal(plain.RootHash(), compressed.RootHash()) {
+		t.Error("Compression changed the root hash")
+	}
+	data, err := compressed.Get([]byte("134567"))
+	if err != nil || !bytes.Equal(data, document) {
+		t.Errorf("Unexpected value %s (err: %v)", data, err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	trie.Put([]byte("123456"), []byte("A"))
+	trie.Put([]byte("134567"), []byte("B"))
+	trie.Commit()
+	root := trie.RootHash()
+
+	readOnly := OpenReadOnly(root, store)
+	data, err := readOnly.Get([]byte("134567"))
+	if err != nil || string(data) != "B" {
+		t.Fatalf("Expected B, got %s (err: %v)", data, err)
+	}
+	if err := readOnly.Put([]byte("123456"), []byte("C")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly on Put, got %v", err)
+	}
+	if err := readOnly.Delete([]byte("123456")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly on Delete, got %v", err)
+	}
+	if err := readOnly.Commit(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly on Commit, got %v", err)
+	}
+	if !bytes.Equal(readOnly.RootHash(), root) {
+		t.Error("Read-only trie was modified")
+	}
+	data, _ = readOnly.Get([]byte("123456"))
+	if string(data) != "A" {
+		t.Errorf("Expected A, got %s", data)
+	}
+}
+
+func TestCommitAtomicity(t *testing.T) {
+	inner := storage.NewMemoryAdapter()
+	store := storage.NewFaultyAdapter(inner)
+	trie := New(nil, store)
+	trie.Put([]byte("123456"), []byte("A"))
+	trie.Put([]byte("134567"), []byte("B"))
+	err := trie.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	committedRoot := trie.RootHash()
+	stored := len(inner.CreateSnapshot())
+
+	trie.Put([]byte("123467"), []byte("C"))
+	trie.Put([]byte("134567"), []byte("D"))
+	// the commit writes more nodes than that, so it fails partway through
+	puts := store.Puts()
+	store.FailPut(2)
+	err = trie.Commit()
+	if !errors.Is(err, storage.ErrInjected) {
+		t.Fatalf("Expected ErrInjected, got %v", err)
+	}
+	if store.Puts()-puts != 2 {
+		t.Errorf("Expected the commit to fail at its second node, got %d puts", store.Puts()-puts)
+	}
+	if len(inner.CreateSnapshot()) != stored {
+		t.Error("Failed commit was partially written")
+	}
+	if !bytes.Equal(trie.oldRoot, committedRoot) {
+		t.Error("Failed commit changed the committed root")
+	}
+
+	trie.Abort()
+	data, err := trie.Get([]byte("134567"))
+	if err != nil || string(data) != "B" {
+		t.Errorf("Expected B after Abort, got %s (err: %v)", data, err)
+	}
+	if _, err := trie.Get([]byte("123467")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	trie.Put([]byte("123467"), []byte("C"))
+	trie.Put([]byte("134567"), []byte("D"))
+	puts = store.Puts()
+	err = trie.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Puts()-puts <= 2 {
+		t.Errorf("Expected a commit of more than 2 nodes, got %d", store.Puts()-puts)
+	}
+}
+
+func TestCorruptedNode(t *testing.T) {
+	inner := storage.NewMemoryAdapter()
+	trie := New(nil, inner)
+	trie.Put([]byte("123456"), []byte("A"))
+	trie.Put([]byte("134567"), []byte("B"))
+	trie.Commit()
+
+	store := storage.NewFaultyAdapter(inner)
+	store.FlipReads(true)
+	rootNode := HashNode(trie.RootHash())
+	_, err := New(&rootNode, store).Get([]byte("123456"))
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("Expected ErrHashMismatch, got %v", err)
+	}
+
+	store.FlipReads(false)
+	data, err := New(&rootNode, store).Get([]byte("123456"))
+	if err != nil || string(data) != "A" {
+		t.Errorf("Expected A, got %s (err: %v)", data, err)
+	}
+}
+
+func TestUndecodableNode(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	data := []byte("not a node")
+	hash := crypto.MainHash(data)
+	store.Put(hash[:], data)
+
+	rootNode := HashNode(hash[:])
+	_, err := New(&rootNode, store).Get([]byte("123456"))
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%x", hash[:])) {
+		t.Errorf("Expected an error naming node %x, got %v", hash[:], err)
+	}
+}
+
+func TestIterateConcurrentWithWitness(t *testing.T) {
+	store := storage.NewMemoryAdapter()
+	trie := New(nil, store)
+	for _, key := range []string{"123456", "134567", "1234567890"} {
+		trie.Put([]byte(key), []byte(key))
+	}
+	trie.Commit()
+	trie.StartWitness()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		trie.Iterate(func(key, value []byte) {})
+		trie.CreateSnapshot()
+	}()
+	trie.Get([]byte("134567"))
+	<-done
+	if len(trie.StopWitness()) == 0 {
+		t.Error("No nodes were recorded")
+	}
+}
@@ -26,4 +26,9 @@ type (
 		Key   []byte
 		Value []byte
 	}
+
+	PersistMultiProof struct {
+		_     struct{} `cbor:",toarray"`
+		Nodes [][]byte
+	}
 )
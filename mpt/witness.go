@@ -0,0 +1,90 @@
+package mpt
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+// Witness is a deduplicated set of serialized nodes keyed by node hash. It
+// holds every node needed to replay a sequence of operations without access
+// to the full store.
+type Witness map[string][]byte
+
+// StartWitness resets the trie to its last committed root and starts
+// recording every node loaded from the store by Get, Put and Delete.
+func (t *Trie) StartWitness() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !bytes.Equal(t.RootHash(), t.oldRoot) {
+		return errors.New("[Trie] cannot record witness with uncommitted changes")
+	}
+	if t.oldRoot == nil {
+		t.root = nil
+	} else {
+		hashNode := HashNode(t.oldRoot)
+		t.root = &hashNode
+	}
+	t.witness = make(Witness)
+	return nil
+}
+
+// StopWitness stops recording and returns the nodes recorded since
+// StartWitness.
+func (t *Trie) StopWitness() Witness {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	witness := t.witness
+	t.witness = nil
+	return witness
+}
+
+// NewWitnessTrie returns a trie with the given root backed only by the nodes
+// of a witness. Operations touching nodes outside the witness fail.
+func NewWitnessTrie(root []byte, witness Witness) *Trie {
+	store := storage.NewMemoryAdapter()
+	for hash, data := range witness {
+		store.Put([]byte(hash), data)
+	}
+	if len(root) == 0 {
+		return New(nil, store)
+	}
+	rootNode := HashNode(root)
+	return New(&rootNode, store)
+}
+
+// Serialize encodes the witness as a PersistTrie with pairs sorted by hash.
+func (w Witness) Serialize() ([]byte, error) {
+	persistTrie := &PersistTrie{}
+	for hash, data := range w {
+		persistTrie.Pairs = append(persistTrie.Pairs, &PersistTriePair{
+			Key:   []byte(hash),
+			Value: data,
+		})
+	}
+	sort.Slice(persistTrie.Pairs, func(i, j int) bool {
+		return bytes.Compare(persistTrie.Pairs[i].Key, persistTrie.Pairs[j].Key) < 0
+	})
+	return cbor.Marshal(persistTrie)
+}
+
+// DeserializeWitness decodes a witness encoded by Witness.Serialize. Nodes
+// that do not match their hash are rejected.
+func DeserializeWitness(data []byte) (Witness, error) {
+	persistTrie := PersistTrie{}
+	err := cbor.Unmarshal(data, &persistTrie)
+	if err != nil {
+		return nil, err
+	}
+	witness := make(Witness, len(persistTrie.Pairs))
+	for _, pair := range persistTrie.Pairs {
+		if !verifyHash(pair.Key, pair.Value) {
+			return nil, hashMismatchError(pair.Key)
+		}
+		witness[string(pair.Key)] = pair.Value
+	}
+	return witness, nil
+}
@@ -0,0 +1,98 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+func replayWitnessOps(trie *Trie) error {
+	for i := 0; i < 10; i++ {
+		_, err := trie.Get([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil {
+			return err
+		}
+	}
+	trie.Get([]byte("key-missing"))
+	for i := 0; i < 5; i++ {
+		err := trie.Put([]byte(fmt.Sprintf("key-%d", i*7)), []byte("updated"))
+		if err != nil {
+			return err
+		}
+	}
+	err := trie.Put([]byte("key-new"), []byte("new"))
+	if err != nil {
+		return err
+	}
+	for i := 40; i < 50; i++ {
+		err := trie.Delete([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWitness(t *testing.T) {
+	trie := New(nil, storage.NewMemoryAdapter())
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		trie.Put(key, key)
+	}
+	trie.Commit()
+	preRoot := trie.RootHash()
+
+	err := trie.StartWitness()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = replayWitnessOps(trie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witness := trie.StopWitness()
+	postRoot := trie.RootHash()
+	if len(witness) == 0 || len(witness) >= len(trie.CreateSnapshot()) {
+		t.Errorf("Unexpected witness size %d", len(witness))
+	}
+
+	data, err := witness.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	witness, err = DeserializeWitness(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := NewWitnessTrie(preRoot, witness)
+	err = replayWitnessOps(verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(verifier.RootHash(), postRoot) {
+		t.Error("Replayed root does not match")
+	}
+
+	for hash := range witness {
+		incomplete := make(Witness)
+		for k, v := range witness {
+			if k != hash {
+				incomplete[k] = v
+			}
+		}
+		if replayWitnessOps(NewWitnessTrie(preRoot, incomplete)) == nil {
+			t.Fatal("Expected replay to fail with incomplete witness")
+		}
+	}
+}
+
+func TestWitnessUncommitted(t *testing.T) {
+	trie := New(nil, storage.NewMemoryAdapter())
+	trie.Put([]byte("123456"), []byte("A"))
+	if trie.StartWitness() == nil {
+		t.Error("Expected error for uncommitted changes")
+	}
+}
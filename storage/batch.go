@@ -0,0 +1,133 @@
+package storage
+
+// KeyValueWriter receives the operations of a replayed batch.
+type KeyValueWriter interface {
+	Put([]byte, []byte) error
+	Delete([]byte) error
+}
+
+// Batch collects puts and deletes until Write applies them at once.
+// Deleting a key that does not exist is not an error.
+type Batch interface {
+	KeyValueWriter
+	// ValueSize returns the number of key and value bytes queued.
+	ValueSize() int
+	Write() error
+	Reset()
+	Replay(KeyValueWriter) error
+}
+
+// Batcher is implemented by adapters supporting atomic write batches.
+type Batcher interface {
+	NewBatch() Batch
+}
+
+// NewBatch returns a batch writing to store. Adapters that do not implement
+// Batcher get a batch applying runs of puts with BatchPut and deletes one by
+// one, which is not atomic.
+func NewBatch(store StorageAdapter) Batch {
+	if b, ok := store.(Batcher); ok {
+		return b.NewBatch()
+	}
+	return &genericBatch{store: store}
+}
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batchOps is an in-memory list of batch operations.
+type batchOps struct {
+	ops  []batchOp
+	size int
+}
+
+func (b *batchOps) Put(key, value []byte) error {
+	b.ops = append(b.ops, batchOp{
+		key:   append([]byte{}, key...),
+		value: append([]byte{}, value...),
+	})
+	b.size += len(key) + len(value)
+	return nil
+}
+
+func (b *batchOps) Delete(key []byte) error {
+	b.ops = append(b.ops, batchOp{
+		key:    append([]byte{}, key...),
+		delete: true,
+	})
+	b.size += len(key)
+	return nil
+}
+
+func (b *batchOps) ValueSize() int { return b.size }
+
+func (b *batchOps) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
+
+func (b *batchOps) Replay(w KeyValueWriter) error {
+	for _, op := range b.ops {
+		var err error
+		if op.delete {
+			err = w.Delete(op.key)
+		} else {
+			err = w.Put(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type genericBatch struct {
+	batchOps
+	store StorageAdapter
+}
+
+func (b *genericBatch) Write() error {
+	var kvs [][2][]byte
+	for _, op := range b.ops {
+		if !op.delete {
+			kvs = append(kvs, [2][]byte{op.key, op.value})
+			continue
+		}
+		if len(kvs) > 0 {
+			if err := b.store.BatchPut(kvs); err != nil {
+				return err
+			}
+			kvs = nil
+		}
+		if b.store.Has(op.key) {
+			if err := b.store.Delete(op.key); err != nil {
+				return err
+			}
+		}
+	}
+	if len(kvs) > 0 {
+		return b.store.BatchPut(kvs)
+	}
+	return nil
+}
+
+// decodingWriter decodes values replayed from an inner batch.
+type decodingWriter struct {
+	w      KeyValueWriter
+	decode func(key, data []byte) ([]byte, error)
+}
+
+func (d *decodingWriter) Put(key, data []byte) error {
+	value, err := d.decode(key, data)
+	if err != nil {
+		return err
+	}
+	return d.w.Put(key, value)
+}
+
+func (d *decodingWriter) Delete(key []byte) error {
+	return d.w.Delete(key)
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"os"
+	"testing"
+)
+
+// plainAdapter hides the optional interfaces of the wrapped adapter.
+type plainAdapter struct {
+	StorageAdapter
+}
+
+func testBatch(t *testing.T, store StorageAdapter) {
+	store.Put([]byte("old"), []byte("value"))
+
+	batch := NewBatch(store)
+	batch.Put([]byte("key1"), []byte("value1"))
+	batch.Delete([]byte("old"))
+	batch.Put([]byte("key2"), []byte("value2"))
+	batch.Delete([]byte("key2"))
+	batch.Delete([]byte("missing"))
+	if batch.ValueSize() != 4+6+3+4+6+4+7 {
+		t.Errorf("Unexpected batch size %d", batch.ValueSize())
+	}
+	if store.Has([]byte("key1")) {
+		t.Error("Batch applied before Write")
+	}
+	err := batch.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := store.Get([]byte("key1"))
+	if err != nil || string(value) != "value1" {
+		t.Errorf("Expected value1, got %s (err: %v)", value, err)
+	}
+	if store.Has([]byte("old")) || store.Has([]byte("key2")) {
+		t.Error("Batch delete was not applied")
+	}
+
+	replayed := NewMemoryAdapter()
+	replayed.Put([]byte("old"), []byte("value"))
+	replayed.Put([]byte("missing"), []byte("value"))
+	err = batch.Replay(replayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replayed.Has([]byte("key1")) || replayed.Has([]byte("old")) {
+		t.Error("Replay did not apply the batch")
+	}
+
+	batch.Reset()
+	if batch.ValueSize() != 0 {
+		t.Error("Reset did not clear the batch")
+	}
+}
+
+func TestMemoryBatch(t *testing.T) {
+	testBatch(t, NewMemoryAdapter())
+}
+
+func TestGenericBatch(t *testing.T) {
+	testBatch(t, plainAdapter{NewMemoryAdapter()})
+}
+
+func TestLevelDBBatch(t *testing.T) {
+	dir, err := os.MkdirTemp("", "leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := NewLevelDBAdapter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	testBatch(t, db)
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bytes"
+
+	"go.etcd.io/bbolt"
+)
+
+// DefaultBoltBucket is the bucket used by NewBoltAdapter when none is given.
+var DefaultBoltBucket = []byte("mpt")
+
+// BoltAdapter stores key-value pairs in a bucket of a bbolt database. Every
+// operation runs in its own transaction; iterators read from a consistent
+// snapshot.
+type BoltAdapter struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+func NewBoltAdapter(path string, bucket []byte) (*BoltAdapter, error) {
+	if len(bucket) == 0 {
+		bucket = DefaultBoltBucket
+	}
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltAdapter{db, append([]byte{}, bucket...)}, nil
+}
+
+func (b *BoltAdapter) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(b.bucket).Get(key)
+		if v == nil {
+			return ErrNotFound
+		}
+		value = append([]byte{}, v...)
+		return nil
+	})
+	return value, err
+}
+
+func (b *BoltAdapter) Put(key, value []byte) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(b.bucket).Put(key, value)
+	})
+}
+
+func (b *BoltAdapter) Has(key []byte) bool {
+	has := false
+	b.db.View(func(tx *bbolt.Tx) error {
+		has = tx.Bucket(b.bucket).Get(key) != nil
+		return nil
+	})
+	return has
+}
+
+func (b *BoltAdapter) Delete(key []byte) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(b.bucket).Delete(key)
+	})
+}
+
+func (b *BoltAdapter) BatchPut(kvs [][2][]byte) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.bucket)
+		for i := range kvs {
+			if err := bucket.Put(kvs[i][0], kvs[i][1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type boltBatch struct {
+	batchOps
+	adapter *BoltAdapter
+}
+
+func (b *BoltAdapter) NewBatch() Batch {
+	return &boltBatch{adapter: b}
+}
+
+func (b *boltBatch) Write() error {
+	return b.adapter.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(b.adapter.bucket)
+		for _, op := range b.ops {
+			var err error
+			if op.delete {
+				err = bucket.Delete(op.key)
+			} else {
+				err = bucket.Put(op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NewIterator returns an iterator holding a read transaction open until
+// Release is called.
+func (b *BoltAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	tx, err := b.db.Begin(false)
+	if err != nil {
+		return &errorIterator{err}
+	}
+	return &boltIterator{
+		tx:     tx,
+		cursor: tx.Bucket(b.bucket).Cursor(),
+		prefix: append([]byte{}, prefix...),
+		seek:   append(append([]byte{}, prefix...), start...),
+	}
+}
+
+type boltIterator struct {
+	tx     *bbolt.Tx
+	cursor *bbolt.Cursor
+	prefix []byte
+	seek   []byte
+	key    []byte
+	value  []byte
+}
+
+func (it *boltIterator) Next() bool {
+	if it.tx == nil {
+		return false
+	}
+	if it.seek != nil {
+		it.key, it.value = it.cursor.Seek(it.seek)
+		it.seek = nil
+	} else {
+		it.key, it.value = it.cursor.Next()
+	}
+	if it.key == nil || !bytes.HasPrefix(it.key, it.prefix) {
+		it.Release()
+		return false
+	}
+	return true
+}
+
+func (it *boltIterator) Key() []byte   { return it.key }
+func (it *boltIterator) Value() []byte { return it.value }
+func (it *boltIterator) Error() error  { return nil }
+
+func (it *boltIterator) Release() {
+	if it.tx != nil {
+		it.tx.Rollback()
+		it.tx = nil
+	}
+	it.key, it.value = nil, nil
+}
+
+func (b *BoltAdapter) Close() {
+	b.db.Close()
+}
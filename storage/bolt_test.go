@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestBoltAdapter(t *testing.T) *BoltAdapter {
+	dir, err := os.MkdirTemp("", "bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	db, err := NewBoltAdapter(filepath.Join(dir, "trie.db"), []byte("nodes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestBoltAdapter(t *testing.T) {
+	db := newTestBoltAdapter(t)
+	db.Put([]byte("key1"), []byte("value1"))
+	db.BatchPut([][2][]byte{{[]byte("key2"), []byte("value2")}, {[]byte("other"), []byte("value3")}})
+
+	value, err := db.Get([]byte("key2"))
+	if err != nil || string(value) != "value2" {
+		t.Fatalf("Expected value2, got %s (err: %v)", value, err)
+	}
+	if _, err := db.Get([]byte("missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	db.Delete([]byte("key1"))
+	if db.Has([]byte("key1")) {
+		t.Error("Delete did not remove the key")
+	}
+
+	var keys []string
+	it := db.NewIterator([]byte("key"), nil)
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Release()
+	if len(keys) != 1 || keys[0] != "key2" {
+		t.Errorf("Expected [key2], got %v", keys)
+	}
+}
+
+func TestBoltBatch(t *testing.T) {
+	testBatch(t, newTestBoltAdapter(t))
+}
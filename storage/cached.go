@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// CacheStats reports the activity of a CachedAdapter.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// CachedAdapter keeps recently read values of an inner adapter in a
+// size-bounded LRU cache. Writes go through to the inner adapter while the
+// cache is locked, so that the cache never holds a value older than the
+// inner adapter's.
+type CachedAdapter struct {
+	inner      StorageAdapter
+	maxBytes   int
+	size       int
+	entries    map[string]*list.Element
+	order      *list.List
+	stats      CacheStats
+	generation uint64
+	lock       *sync.Mutex
+}
+
+type cacheEntry struct {
+	key   string
+	value []byte
+}
+
+// NewCachedAdapter returns a CachedAdapter holding at most maxBytes of keys
+// and values.
+func NewCachedAdapter(inner StorageAdapter, maxBytes int) *CachedAdapter {
+	return &CachedAdapter{
+		inner:    inner,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		lock:     &sync.Mutex{},
+	}
+}
+
+func (c *CachedAdapter) Get(key []byte) ([]byte, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext forwards ctx to the inner adapter on a cache miss. The other
+// context methods forward it likewise.
+func (c *CachedAdapter) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	c.lock.Lock()
+	if el, ok := c.entries[string(key)]; ok {
+		c.order.MoveToFront(el)
+		c.stats.Hits++
+		value := append([]byte{}, el.Value.(*cacheEntry).value...)
+		c.lock.Unlock()
+		return value, nil
+	}
+	c.stats.Misses++
+	generation := c.generation
+	c.lock.Unlock()
+
+	value, err := GetContext(ctx, c.inner, key)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// skip caching if a write happened while reading from the inner adapter
+	if generation == c.generation {
+		c.add(key, value)
+	}
+	return value, nil
+}
+
+func (c *CachedAdapter) Put(key, value []byte) error {
+	return c.PutContext(context.Background(), key, value)
+}
+
+func (c *CachedAdapter) PutContext(ctx context.Context, key, value []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	err := PutContext(ctx, c.inner, key, value)
+	c.generation++
+	if err != nil {
+		c.remove(key)
+		return err
+	}
+	c.add(key, value)
+	return nil
+}
+
+func (c *CachedAdapter) Has(key []byte) bool {
+	has, _ := c.HasContext(context.Background(), key)
+	return has
+}
+
+func (c *CachedAdapter) HasContext(ctx context.Context, key []byte) (bool, error) {
+	c.lock.Lock()
+	if _, ok := c.entries[string(key)]; ok {
+		c.stats.Hits++
+		c.lock.Unlock()
+		return true, nil
+	}
+	c.stats.Misses++
+	c.lock.Unlock()
+	return HasContext(ctx, c.inner, key)
+}
+
+func (c *CachedAdapter) Delete(key []byte) error {
+	return c.DeleteContext(context.Background(), key)
+}
+
+func (c *CachedAdapter) DeleteContext(ctx context.Context, key []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	err := DeleteContext(ctx, c.inner, key)
+	c.generation++
+	c.remove(key)
+	return err
+}
+
+func (c *CachedAdapter) BatchPut(kvs [][2][]byte) error {
+	return c.BatchPutContext(context.Background(), kvs)
+}
+
+func (c *CachedAdapter) BatchPutContext(ctx context.Context, kvs [][2][]byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	err := BatchPutContext(ctx, c.inner, kvs)
+	c.generation++
+	for _, kvp := range kvs {
+		if err != nil {
+			c.remove(kvp[0])
+		} else {
+			c.add(kvp[0], kvp[1])
+		}
+	}
+	return err
+}
+
+type cachedBatch struct {
+	Batch
+	cache *CachedAdapter
+	keys  [][]byte
+}
+
+// NewBatch returns a batch of the inner adapter that invalidates the cached
+// entries of its keys when written.
+func (c *CachedAdapter) NewBatch() Batch {
+	return &cachedBatch{Batch: NewBatch(c.inner), cache: c}
+}
+
+func (b *cachedBatch) Put(key, value []byte) error {
+	b.keys = append(b.keys, append([]byte{}, key...))
+	return b.Batch.Put(key, value)
+}
+
+func (b *cachedBatch) Delete(key []byte) error {
+	b.keys = append(b.keys, append([]byte{}, key...))
+	return b.Batch.Delete(key)
+}
+
+func (b *cachedBatch) Write() error {
+	b.cache.lock.Lock()
+	defer b.cache.lock.Unlock()
+	err := b.Batch.Write()
+	b.cache.generation++
+	for _, key := range b.keys {
+		b.cache.remove(key)
+	}
+	return err
+}
+
+func (b *cachedBatch) Reset() {
+	b.Batch.Reset()
+	b.keys = nil
+}
+
+// NewIterator iterates over the inner adapter, bypassing the cache.
+func (c *CachedAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	iteratee, ok := c.inner.(Iteratee)
+	if !ok {
+		return &errorIterator{errors.New("[Cached] inner adapter cannot be iterated")}
+	}
+	return iteratee.NewIterator(prefix, start)
+}
+
+// Stats returns a copy of the cache statistics.
+func (c *CachedAdapter) Stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stats
+}
+
+func (c *CachedAdapter) Close() {
+	c.inner.Close()
+}
+
+// add caches a copy of value, evicting least recently used entries to stay
+// within maxBytes. The lock must be held.
+func (c *CachedAdapter) add(key, value []byte) {
+	size := len(key) + len(value)
+	if size > c.maxBytes {
+		c.remove(key)
+		return
+	}
+	if el, ok := c.entries[string(key)]; ok {
+		entry := el.Value.(*cacheEntry)
+		c.size += len(value) - len(entry.value)
+		entry.value = append([]byte{}, value...)
+		c.order.MoveToFront(el)
+	} else {
+		entry := &cacheEntry{key: string(key), value: append([]byte{}, value...)}
+		c.entries[entry.key] = c.order.PushFront(entry)
+		c.size += size
+	}
+	for c.size > c.maxBytes {
+		el := c.order.Back()
+		entry := el.Value.(*cacheEntry)
+		c.order.Remove(el)
+		delete(c.entries, entry.key)
+		c.size -= len(entry.key) + len(entry.value)
+		c.stats.Evictions++
+	}
+}
+
+// remove drops key from the cache. The lock must be held.
+func (c *CachedAdapter) remove(key []byte) {
+	if el, ok := c.entries[string(key)]; ok {
+		entry := el.Value.(*cacheEntry)
+		c.order.Remove(el)
+		delete(c.entries, entry.key)
+		c.size -= len(entry.key) + len(entry.value)
+	}
+}
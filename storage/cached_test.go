@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCachedAdapter(t *testing.T) {
+	inner := NewMemoryAdapter()
+	inner.Put([]byte("key1"), []byte("value1"))
+	inner.Put([]byte("key2"), []byte("value2"))
+	inner.Put([]byte("key3"), []byte("value3"))
+
+	// room for two entries of 10 bytes each
+	cache := NewCachedAdapter(inner, 20)
+	for _, key := range []string{"key1", "key1", "key2", "key1", "key3"} {
+		value, err := cache.Get([]byte(key))
+		if err != nil || string(value) != "value"+key[3:] {
+			t.Fatalf("Unexpected value %s for %s (err: %v)", value, key, err)
+		}
+	}
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 3 || stats.Evictions != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	// key2 was least recently used and got evicted
+	cache.Has([]byte("key1"))
+	cache.Has([]byte("key2"))
+	stats = cache.Stats()
+	if stats.Hits != 3 || stats.Misses != 4 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// write-through
+	cache.Put([]byte("key1"), []byte("new111"))
+	value, _ := inner.Get([]byte("key1"))
+	if string(value) != "new111" {
+		t.Error("Put was not written through")
+	}
+	value, _ = cache.Get([]byte("key1"))
+	if string(value) != "new111" {
+		t.Errorf("Expected new111, got %s", value)
+	}
+
+	// invalidation
+	cache.Delete([]byte("key1"))
+	if _, err := cache.Get([]byte("key1")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after Delete, got %v", err)
+	}
+	cache.Get([]byte("key3"))
+	batch := cache.NewBatch()
+	batch.Delete([]byte("key3"))
+	batch.Write()
+	if cache.Has([]byte("key3")) {
+		t.Error("Batch delete did not invalidate the cache")
+	}
+
+	it := NewCachedAdapter(plainAdapter{inner}, 20).NewIterator(nil, nil)
+	if it.Next() || it.Error() == nil {
+		t.Error("Expected iteration error for a non-iterable inner adapter")
+	}
+}
+
+// slowDeleteAdapter widens the window between a cache update and the inner
+// delete.
+type slowDeleteAdapter struct {
+	StorageAdapter
+}
+
+func (s slowDeleteAdapter) Delete(key []byte) error {
+	time.Sleep(time.Millisecond)
+	return s.StorageAdapter.Delete(key)
+}
+
+func TestCachedAdapterConcurrentDelete(t *testing.T) {
+	cache := NewCachedAdapter(slowDeleteAdapter{NewMemoryAdapter()}, 1<<10)
+	key := []byte("key")
+	for i := 0; i < 50; i++ {
+		cache.Put(key, []byte("value"))
+		var wg sync.WaitGroup
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					cache.Get(key)
+				}
+			}()
+		}
+		cache.Delete(key)
+		wg.Wait()
+		if value, err := cache.Get(key); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Deleted key is still served: %s (err: %v)", value, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects the codec of a CompressedAdapter. Its value is stored
+// after the header magic in front of every value written.
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionSnappy
+	CompressionZstd
+	CompressionGzip
+)
+
+// MaxDecompressedSize is the largest value a CompressedAdapter decompresses.
+// Larger values are rejected before being inflated in memory.
+const MaxDecompressedSize = 64 << 20
+
+var errDecompressedSize = fmt.Errorf("[Compressed] value larger than %d bytes when decompressed", MaxDecompressedSize)
+
+// compressedMagic starts the header of every value written by a
+// CompressedAdapter. Its first byte is the CBOR break code, which cannot
+// start a CBOR node, so legacy raw nodes are never taken for a header.
+var compressedMagic = []byte{0xff, 'M', 'P', 'C'}
+
+// CompressedAdapter compresses values of an inner adapter. Compressed values
+// start with a header made of a magic prefix and a byte naming their codec.
+// Values shorter than the threshold, or that do not shrink, are stored raw,
+// and values without the magic, such as CBOR nodes written before
+// compression was enabled, are returned as they are. Raw values starting
+// with the magic themselves are stored with a header; written before the
+// adapter was used, they cannot be told apart, so the adapter must only be
+// put over existing data holding CBOR nodes.
+type CompressedAdapter struct {
+	inner       StorageAdapter
+	compression Compression
+	threshold   int
+	encoder     *zstd.Encoder
+	decoder     *zstd.Decoder
+}
+
+func NewCompressedAdapter(inner StorageAdapter, compression Compression, threshold int) (*CompressedAdapter, error) {
+	if compression > CompressionGzip {
+		return nil, fmt.Errorf("[Compressed] unknown compression %d", compression)
+	}
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+	if err != nil {
+		return nil, err
+	}
+	return &CompressedAdapter{
+		inner:       inner,
+		compression: compression,
+		threshold:   threshold,
+		encoder:     encoder,
+		decoder:     decoder,
+	}, nil
+}
+
+func (c *CompressedAdapter) encode(value []byte) ([]byte, error) {
+	var compressed []byte
+	if c.compression != CompressionNone && len(value) >= c.threshold {
+		switch c.compression {
+		case CompressionSnappy:
+			compressed = snappy.Encode(nil, value)
+		case CompressionZstd:
+			compressed = c.encoder.EncodeAll(value, nil)
+		case CompressionGzip:
+			var buf bytes.Buffer
+			writer := gzip.NewWriter(&buf)
+			_, err := writer.Write(value)
+			if err != nil {
+				return nil, err
+			}
+			err = writer.Close()
+			if err != nil {
+				return nil, err
+			}
+			compressed = buf.Bytes()
+		}
+	}
+	if compressed == nil || len(compressed) >= len(value) {
+		if bytes.HasPrefix(value, compressedMagic) {
+			// a raw value starting with the magic keeps a header to tell
+			// it apart
+			return c.header(CompressionNone, value), nil
+		}
+		return value, nil
+	}
+	return c.header(c.compression, compressed), nil
+}
+
+// header returns data prefixed with the header of compression.
+func (c *CompressedAdapter) header(compression Compression, data []byte) []byte {
+	encoded := make([]byte, 0, len(compressedMagic)+1+len(data))
+	encoded = append(encoded, compressedMagic...)
+	encoded = append(encoded, byte(compression))
+	return append(encoded, data...)
+}
+
+func (c *CompressedAdapter) decode(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, compressedMagic) || len(data) == len(compressedMagic) {
+		// legacy value written without a header
+		return data, nil
+	}
+	compression := Compression(data[len(compressedMagic)])
+	data = data[len(compressedMagic)+1:]
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		size, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if size > MaxDecompressedSize {
+			return nil, errDecompressedSize
+		}
+		return snappy.Decode(nil, data)
+	case CompressionZstd:
+		value, err := c.decoder.DecodeAll(data, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+			return nil, errDecompressedSize
+		}
+		return value, err
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		value, err := io.ReadAll(io.LimitReader(reader, MaxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(value) > MaxDecompressedSize {
+			return nil, errDecompressedSize
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("[Compressed] unknown compression %d", compression)
+}
+
+func (c *CompressedAdapter) Get(key []byte) ([]byte, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+func (c *CompressedAdapter) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	data, err := GetContext(ctx, c.inner, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.decode(data)
+}
+
+func (c *CompressedAdapter) Put(key, value []byte) error {
+	return c.PutContext(context.Background(), key, value)
+}
+
+func (c *CompressedAdapter) PutContext(ctx context.Context, key, value []byte) error {
+	data, err := c.encode(value)
+	if err != nil {
+		return err
+	}
+	return PutContext(ctx, c.inner, key, data)
+}
+
+func (c *CompressedAdapter) Has(key []byte) bool {
+	return c.inner.Has(key)
+}
+
+func (c *CompressedAdapter) HasContext(ctx context.Context, key []byte) (bool, error) {
+	return HasContext(ctx, c.inner, key)
+}
+
+func (c *CompressedAdapter) Delete(key []byte) error {
+	return c.inner.Delete(key)
+}
+
+func (c *CompressedAdapter) DeleteContext(ctx context.Context, key []byte) error {
+	return DeleteContext(ctx, c.inner, key)
+}
+
+func (c *CompressedAdapter) BatchPut(kvs [][2][]byte) error {
+	return c.BatchPutContext(context.Background(), kvs)
+}
+
+func (c *CompressedAdapter) BatchPutContext(ctx context.Context, kvs [][2][]byte) error {
+	encoded := make([][2][]byte, len(kvs))
+	for i := range kvs {
+		data, err := c.encode(kvs[i][1])
+		if err != nil {
+			return err
+		}
+		encoded[i] = [2][]byte{kvs[i][0], data}
+	}
+	return BatchPutContext(ctx, c.inner, encoded)
+}
+
+type compressedBatch struct {
+	Batch
+	adapter *CompressedAdapter
+}
+
+func (c *CompressedAdapter) NewBatch() Batch {
+	return &compressedBatch{NewBatch(c.inner), c}
+}
+
+func (b *compressedBatch) Put(key, value []byte) error {
+	data, err := b.adapter.encode(value)
+	if err != nil {
+		return err
+	}
+	return b.Batch.Put(key, data)
+}
+
+func (b *compressedBatch) Replay(w KeyValueWriter) error {
+	return b.Batch.Replay(&decodingWriter{w, b.adapter.decodeValue})
+}
+
+func (c *CompressedAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	iteratee, ok := c.inner.(Iteratee)
+	if !ok {
+		return &errorIterator{fmt.Errorf("[Compressed] inner adapter cannot be iterated")}
+	}
+	return &decodingIterator{Iterator: iteratee.NewIterator(prefix, start), decode: c.decodeValue}
+}
+
+func (c *CompressedAdapter) decodeValue(key, data []byte) ([]byte, error) {
+	return c.decode(data)
+}
+
+func (c *CompressedAdapter) Close() {
+	c.encoder.Close()
+	c.decoder.Close()
+	c.inner.Close()
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func TestCompressedAdapter(t *testing.T) {
+	document := []byte(strings.Repeat(`{"name":"value","list":[1,2,3]},`, 100))
+	for _, compression := range []Compression{CompressionNone, CompressionSnappy, CompressionZstd, CompressionGzip} {
+		inner := NewMemoryAdapter()
+		// legacy CBOR nodes written without a header, the second one starting
+		// with a byte that is also a codec number
+		legacy := []byte{0xa1, 0x0c, 0x43, 'a', 'b', 'c'}
+		inner.Put([]byte("legacy"), legacy)
+		legacyList := []byte{0x02, 0x01, 0x02}
+		inner.Put([]byte("legacyList"), legacyList)
+
+		store, err := NewCompressedAdapter(inner, compression, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Put([]byte("small"), []byte("tiny"))
+		magic := append(append([]byte{}, compressedMagic...), byte(CompressionGzip), 'x')
+		store.Put([]byte("magic"), magic)
+		store.BatchPut([][2][]byte{{[]byte("document"), document}})
+
+		for key, expected := range map[string][]byte{"legacy": legacy, "legacyList": legacyList, "small": []byte("tiny"), "magic": magic, "document": document} {
+			value, err := store.Get([]byte(key))
+			if err != nil || !bytes.Equal(value, expected) {
+				t.Errorf("compression %d: unexpected value for %s (err: %v)", compression, key, err)
+			}
+		}
+		raw, _ := inner.Get([]byte("small"))
+		if string(raw) != "tiny" {
+			t.Errorf("compression %d: value below threshold was not stored raw", compression)
+		}
+		raw, _ = inner.Get([]byte("magic"))
+		if !bytes.HasPrefix(raw, compressedMagic) || raw[len(compressedMagic)] != byte(CompressionNone) {
+			t.Errorf("compression %d: raw value starting with the magic has no header", compression)
+		}
+		raw, _ = inner.Get([]byte("document"))
+		if compression != CompressionNone && (raw[len(compressedMagic)] != byte(compression) || len(raw) >= len(document)) {
+			t.Errorf("compression %d: document was not compressed", compression)
+		}
+
+		it := store.NewIterator([]byte("doc"), nil)
+		if !it.Next() || !bytes.Equal(it.Value(), document) {
+			t.Errorf("compression %d: iterator returned a compressed value", compression)
+		}
+		it.Release()
+		store.Close()
+	}
+}
+
+func TestCompressedAdapterUnknownCompression(t *testing.T) {
+	_, err := NewCompressedAdapter(NewMemoryAdapter(), Compression(42), 0)
+	if err == nil {
+		t.Error("Expected error for unknown compression")
+	}
+}
+
+func TestCompressedAdapterDecompressionBomb(t *testing.T) {
+	store, err := NewCompressedAdapter(NewMemoryAdapter(), CompressionZstd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	bomb := make([]byte, MaxDecompressedSize+1)
+
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	writer.Write(bomb)
+	writer.Close()
+	// snappy only reads the decoded length from the header
+	snappyHeader := snappy.Encode(nil, bomb)[:4]
+	for compression, data := range map[Compression][]byte{
+		CompressionSnappy: snappyHeader,
+		CompressionZstd:   store.encoder.EncodeAll(bomb, nil),
+		CompressionGzip:   gzipped.Bytes(),
+	} {
+		_, err := store.decode(store.header(compression, data))
+		if err != errDecompressedSize {
+			t.Errorf("compression %d: Expected an error for a value over MaxDecompressedSize", compression)
+		}
+	}
+}
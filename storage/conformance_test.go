@@ -0,0 +1,116 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+	"github.com/vldmkr/merkle-patricia-trie/storage/storagetest"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		return storage.NewMemoryAdapter()
+	})
+}
+
+func TestMemoryWALConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		kv, err := storage.NewMemoryAdapterWithWAL(t.TempDir(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return kv
+	})
+}
+
+func TestShardedConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		return storage.NewShardedMemoryAdapter(0)
+	})
+}
+
+func TestLevelDBConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		db, err := storage.NewLevelDBAdapter(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestPebbleConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		db, err := storage.NewPebbleAdapter(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestBoltConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		db, err := storage.NewBoltAdapter(filepath.Join(t.TempDir(), "trie.db"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestFileLogConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		db, err := storage.NewFileLogAdapter(filepath.Join(t.TempDir(), "trie.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestPrefixedConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		return storage.NewPrefixedAdapter(storage.NewMemoryAdapter(), []byte("p/"))
+	})
+}
+
+func TestOverlayConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		return storage.NewOverlayAdapter(storage.NewMemoryAdapter())
+	})
+}
+
+func TestCachedConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		return storage.NewCachedAdapter(storage.NewMemoryAdapter(), 1<<20)
+	})
+}
+
+func TestCompressedConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		store, err := storage.NewCompressedAdapter(storage.NewMemoryAdapter(), storage.CompressionSnappy, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestEncryptedConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		keys := &storage.StaticKeyProvider{Keys: map[uint32][]byte{1: make([]byte, 32)}, Current: 1}
+		store, err := storage.NewEncryptedAdapter(storage.NewMemoryAdapter(), keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestMetricsConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.StorageAdapter {
+		return storage.NewMetricsAdapter(storage.NewMemoryAdapter(), storage.NewMetrics())
+	})
+}
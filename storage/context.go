@@ -0,0 +1,67 @@
+package storage
+
+import "context"
+
+// ContextAdapter is implemented by adapters whose operations can be
+// cancelled or given a deadline through a context. Wrapping adapters pass
+// the context on to the adapter they wrap.
+type ContextAdapter interface {
+	StorageAdapter
+	GetContext(context.Context, []byte) ([]byte, error)
+	PutContext(context.Context, []byte, []byte) error
+	HasContext(context.Context, []byte) (bool, error)
+	DeleteContext(context.Context, []byte) error
+	BatchPutContext(context.Context, [][2][]byte) error
+}
+
+// GetContext reads a key, passing ctx to adapters implementing
+// ContextAdapter. Other adapters are only called if ctx is not done.
+func GetContext(ctx context.Context, store StorageAdapter, key []byte) ([]byte, error) {
+	if s, ok := store.(ContextAdapter); ok {
+		return s.GetContext(ctx, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return store.Get(key)
+}
+
+func PutContext(ctx context.Context, store StorageAdapter, key, value []byte) error {
+	if s, ok := store.(ContextAdapter); ok {
+		return s.PutContext(ctx, key, value)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return store.Put(key, value)
+}
+
+func HasContext(ctx context.Context, store StorageAdapter, key []byte) (bool, error) {
+	if s, ok := store.(ContextAdapter); ok {
+		return s.HasContext(ctx, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return store.Has(key), nil
+}
+
+func DeleteContext(ctx context.Context, store StorageAdapter, key []byte) error {
+	if s, ok := store.(ContextAdapter); ok {
+		return s.DeleteContext(ctx, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return store.Delete(key)
+}
+
+func BatchPutContext(ctx context.Context, store StorageAdapter, kvs [][2][]byte) error {
+	if s, ok := store.(ContextAdapter); ok {
+		return s.BatchPutContext(ctx, kvs)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return store.BatchPut(kvs)
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestContextAdapters(t *testing.T) {
+	memory := NewMemoryAdapter()
+	compressed, _ := NewCompressedAdapter(memory, CompressionSnappy, 0)
+	encrypted, _ := NewEncryptedAdapter(memory, &StaticKeyProvider{Keys: map[uint32][]byte{1: make([]byte, 32)}, Current: 1})
+	for name, store := range map[string]StorageAdapter{
+		"Memory":     memory,
+		"Prefixed":   NewPrefixedAdapter(memory, []byte("p/")),
+		"Cached":     NewCachedAdapter(memory, 1<<10),
+		"Metrics":    NewMetricsAdapter(memory, NewMetrics()),
+		"Compressed": compressed,
+		"Encrypted":  encrypted,
+		"Overlay":    NewOverlayAdapter(memory),
+		"ReadOnly":   ReadOnly(memory),
+	} {
+		if _, ok := store.(ContextAdapter); !ok {
+			t.Errorf("%s does not implement ContextAdapter", name)
+		}
+	}
+}
+
+func TestContextCancelled(t *testing.T) {
+	memory := NewMemoryAdapter()
+	memory.Put([]byte("p/key"), []byte("value"))
+	// context errors travel through the wrappers to the backend
+	store := NewCachedAdapter(NewPrefixedAdapter(memory, []byte("p/")), 1<<10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := GetContext(ctx, store, []byte("key")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled on Get, got %v", err)
+	}
+	if _, err := HasContext(ctx, store, []byte("key")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled on Has, got %v", err)
+	}
+	if err := PutContext(ctx, store, []byte("key"), []byte("new")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled on Put, got %v", err)
+	}
+	if err := BatchPutContext(ctx, store, [][2][]byte{{[]byte("key2"), []byte("value2")}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled on BatchPut, got %v", err)
+	}
+	if err := DeleteContext(ctx, store, []byte("key")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled on Delete, got %v", err)
+	}
+	value, err := memory.Get([]byte("p/key"))
+	if err != nil || string(value) != "value" || memory.Has([]byte("p/key2")) {
+		t.Errorf("Cancelled operations reached the store: %s (err: %v)", value, err)
+	}
+
+	// adapters without context support are not called once ctx is done
+	plain := plainAdapter{memory}
+	if _, err := GetContext(ctx, plain, []byte("p/key")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from the fallback, got %v", err)
+	}
+	has, err := HasContext(context.Background(), plain, []byte("p/key"))
+	if err != nil || !has {
+		t.Errorf("Expected the fallback to find the key, got %v (err: %v)", has, err)
+	}
+}
+
+func TestLevelDBContext(t *testing.T) {
+	db, err := NewLevelDBAdapter(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	err = db.BatchPutContext(ctx, [][2][]byte{{[]byte("key"), []byte("value")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	has, err := db.HasContext(ctx, []byte("key"))
+	if err != nil || !has {
+		t.Errorf("Expected the key, got %v (err: %v)", has, err)
+	}
+	cancel()
+	if err := db.DeleteContext(ctx, []byte("key")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if !db.Has([]byte("key")) {
+		t.Error("Cancelled delete reached the database")
+	}
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// KeyProvider supplies the AES keys of an EncryptedAdapter. Keys must be 16,
+// 24 or 32 bytes long.
+type KeyProvider interface {
+	// CurrentKey returns the key used for new writes and its ID.
+	CurrentKey() (uint32, []byte, error)
+	// Key returns the key with the given ID, to read older values.
+	Key(uint32) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider holding its keys in memory. Rotating
+// means adding a key and making it Current.
+type StaticKeyProvider struct {
+	Keys    map[uint32][]byte
+	Current uint32
+}
+
+func (p *StaticKeyProvider) CurrentKey() (uint32, []byte, error) {
+	key, err := p.Key(p.Current)
+	return p.Current, key, err
+}
+
+func (p *StaticKeyProvider) Key(id uint32) ([]byte, error) {
+	if key, ok := p.Keys[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("[Encrypted] unknown key id %d", id)
+}
+
+const keyIDSize = 4
+
+// EncryptedAdapter encrypts values of an inner adapter with AES-GCM. Lookup
+// keys are stored in clear and authenticated as additional data, so that a
+// value cannot be moved to another key. Every value starts with the ID of
+// the key it was encrypted with, followed by the nonce.
+type EncryptedAdapter struct {
+	inner StorageAdapter
+	keys  KeyProvider
+	aeads map[uint32]cipher.AEAD
+	lock  *sync.Mutex
+}
+
+func NewEncryptedAdapter(inner StorageAdapter, keys KeyProvider) (*EncryptedAdapter, error) {
+	e := &EncryptedAdapter{
+		inner: inner,
+		keys:  keys,
+		aeads: make(map[uint32]cipher.AEAD),
+		lock:  &sync.Mutex{},
+	}
+	// fail early on a missing or malformed current key
+	_, _, err := e.currentAEAD()
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *EncryptedAdapter) aead(id uint32, key []byte) (cipher.AEAD, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if aead, ok := e.aeads[id]; ok {
+		return aead, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	e.aeads[id] = aead
+	return aead, nil
+}
+
+func (e *EncryptedAdapter) currentAEAD() (uint32, cipher.AEAD, error) {
+	id, key, err := e.keys.CurrentKey()
+	if err != nil {
+		return 0, nil, err
+	}
+	aead, err := e.aead(id, key)
+	return id, aead, err
+}
+
+func (e *EncryptedAdapter) encrypt(key, value []byte) ([]byte, error) {
+	id, aead, err := e.currentAEAD()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, keyIDSize+aead.NonceSize(), keyIDSize+aead.NonceSize()+len(value)+aead.Overhead())
+	binary.BigEndian.PutUint32(data, id)
+	_, err = rand.Read(data[keyIDSize:])
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(data, data[keyIDSize:], value, key), nil
+}
+
+func (e *EncryptedAdapter) decrypt(key, data []byte) ([]byte, error) {
+	if len(data) < keyIDSize {
+		return nil, errors.New("[Encrypted] value too short")
+	}
+	id := binary.BigEndian.Uint32(data)
+	secret, err := e.keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := e.aead(id, secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < keyIDSize+aead.NonceSize() {
+		return nil, errors.New("[Encrypted] value too short")
+	}
+	nonce := data[keyIDSize : keyIDSize+aead.NonceSize()]
+	value, err := aead.Open(nil, nonce, data[keyIDSize+aead.NonceSize():], key)
+	if err != nil {
+		return nil, fmt.Errorf("[Encrypted] cannot decrypt %x: %w", key, err)
+	}
+	return value, nil
+}
+
+func (e *EncryptedAdapter) Get(key []byte) ([]byte, error) {
+	return e.GetContext(context.Background(), key)
+}
+
+func (e *EncryptedAdapter) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	data, err := GetContext(ctx, e.inner, key)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(key, data)
+}
+
+func (e *EncryptedAdapter) Put(key, value []byte) error {
+	return e.PutContext(context.Background(), key, value)
+}
+
+func (e *EncryptedAdapter) PutContext(ctx context.Context, key, value []byte) error {
+	data, err := e.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return PutContext(ctx, e.inner, key, data)
+}
+
+func (e *EncryptedAdapter) Has(key []byte) bool {
+	return e.inner.Has(key)
+}
+
+func (e *EncryptedAdapter) HasContext(ctx context.Context, key []byte) (bool, error) {
+	return HasContext(ctx, e.inner, key)
+}
+
+func (e *EncryptedAdapter) Delete(key []byte) error {
+	return e.inner.Delete(key)
+}
+
+func (e *EncryptedAdapter) DeleteContext(ctx context.Context, key []byte) error {
+	return DeleteContext(ctx, e.inner, key)
+}
+
+func (e *EncryptedAdapter) BatchPut(kvs [][2][]byte) error {
+	return e.BatchPutContext(context.Background(), kvs)
+}
+
+func (e *EncryptedAdapter) BatchPutContext(ctx context.Context, kvs [][2][]byte) error {
+	encrypted := make([][2][]byte, len(kvs))
+	for i := range kvs {
+		data, err := e.encrypt(kvs[i][0], kvs[i][1])
+		if err != nil {
+			return err
+		}
+		encrypted[i] = [2][]byte{kvs[i][0], data}
+	}
+	return BatchPutContext(ctx, e.inner, encrypted)
+}
+
+type encryptedBatch struct {
+	Batch
+	adapter *EncryptedAdapter
+}
+
+func (e *EncryptedAdapter) NewBatch() Batch {
+	return &encryptedBatch{NewBatch(e.inner), e}
+}
+
+func (b *encryptedBatch) Put(key, value []byte) error {
+	data, err := b.adapter.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return b.Batch.Put(key, data)
+}
+
+func (b *encryptedBatch) Replay(w KeyValueWriter) error {
+	return b.Batch.Replay(&decodingWriter{w, b.adapter.decrypt})
+}
+
+func (e *EncryptedAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	iteratee, ok := e.inner.(Iteratee)
+	if !ok {
+		return &errorIterator{errors.New("[Encrypted] inner adapter cannot be iterated")}
+	}
+	return &decodingIterator{Iterator: iteratee.NewIterator(prefix, start), decode: e.decrypt}
+}
+
+// Rotate re-encrypts every value that is not encrypted with the current key,
+// in a single batch. The inner adapter must implement Iteratee. It returns
+// the number of re-encrypted values.
+func (e *EncryptedAdapter) Rotate() (int, error) {
+	iteratee, ok := e.inner.(Iteratee)
+	if !ok {
+		return 0, errors.New("[Encrypted] inner adapter cannot be iterated")
+	}
+	current, _, err := e.keys.CurrentKey()
+	if err != nil {
+		return 0, err
+	}
+	batch := NewBatch(e.inner)
+	rotated := 0
+	it := iteratee.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		data := it.Value()
+		if len(data) >= keyIDSize && binary.BigEndian.Uint32(data) == current {
+			continue
+		}
+		value, err := e.decrypt(it.Key(), data)
+		if err != nil {
+			return 0, err
+		}
+		data, err = e.encrypt(it.Key(), value)
+		if err != nil {
+			return 0, err
+		}
+		err = batch.Put(it.Key(), data)
+		if err != nil {
+			return 0, err
+		}
+		rotated++
+	}
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	return rotated, batch.Write()
+}
+
+func (e *EncryptedAdapter) Close() {
+	e.inner.Close()
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptedAdapter(t *testing.T) {
+	keys := &StaticKeyProvider{
+		Keys:    map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)},
+		Current: 1,
+	}
+	inner := NewMemoryAdapter()
+	store, err := NewEncryptedAdapter(inner, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put([]byte("key1"), []byte("secret1"))
+	store.BatchPut([][2][]byte{{[]byte("key2"), []byte("secret2")}})
+
+	raw, _ := inner.Get([]byte("key1"))
+	if bytes.Contains(raw, []byte("secret1")) {
+		t.Error("Value stored in clear")
+	}
+	value, err := store.Get([]byte("key1"))
+	if err != nil || string(value) != "secret1" {
+		t.Fatalf("Expected secret1, got %s (err: %v)", value, err)
+	}
+	if !store.Has([]byte("key2")) {
+		t.Error("Lookup key is not usable")
+	}
+
+	// a value moved to another key fails authentication
+	inner.Put([]byte("key3"), raw)
+	if _, err := store.Get([]byte("key3")); err == nil {
+		t.Error("Expected error for value moved to another key")
+	}
+	store.Delete([]byte("key3"))
+
+	// rotate to a new key, old values stay readable until re-encrypted
+	keys.Keys[2] = bytes.Repeat([]byte{2}, 32)
+	keys.Current = 2
+	store.Put([]byte("key4"), []byte("secret4"))
+	rotated, err := store.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated != 2 {
+		t.Errorf("Expected 2 rotated values, got %d", rotated)
+	}
+	delete(keys.Keys, 1)
+	for key, expected := range map[string]string{"key1": "secret1", "key2": "secret2", "key4": "secret4"} {
+		value, err := store.Get([]byte(key))
+		if err != nil || string(value) != expected {
+			t.Errorf("Expected %s, got %s (err: %v)", expected, value, err)
+		}
+	}
+}
+
+func TestEncryptedAdapterInvalidKey(t *testing.T) {
+	keys := &StaticKeyProvider{Keys: map[uint32][]byte{1: []byte("short")}, Current: 1}
+	_, err := NewEncryptedAdapter(NewMemoryAdapter(), keys)
+	if err == nil {
+		t.Error("Expected error for invalid key")
+	}
+}
@@ -0,0 +1,13 @@
+package storage
+
+import "errors"
+
+var (
+	// ErrNotFound is returned by adapters when a key is not present in the
+	// store.
+	ErrNotFound = errors.New("key not found")
+	// ErrReadOnly is returned by read-only adapters on any write.
+	ErrReadOnly = errors.New("store is read-only")
+	// ErrClosed is returned by adapters that cannot be used once closed.
+	ErrClosed = errors.New("store is closed")
+)
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrInjected is returned by a FaultyAdapter for a scheduled failure.
+var ErrInjected = errors.New("[Faulty] injected failure")
+
+// FaultyAdapter wraps an adapter and injects faults following a schedule set
+// with its methods. It is meant for testing how callers handle a failing
+// store. Puts are counted per key, including each pair of a BatchPut and
+// each put of a batch.
+type FaultyAdapter struct {
+	inner      StorageAdapter
+	lock       *sync.Mutex
+	puts       int
+	failPut    int
+	dropWrites bool
+	flipReads  bool
+	latency    time.Duration
+}
+
+func NewFaultyAdapter(inner StorageAdapter) *FaultyAdapter {
+	return &FaultyAdapter{inner: inner, lock: &sync.Mutex{}}
+}
+
+// FailPut makes the nth put from now fail with ErrInjected, once. A BatchPut
+// or batch write containing it fails as a whole without writing anything.
+// Zero disarms a pending failure.
+func (f *FaultyAdapter) FailPut(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if n <= 0 {
+		f.failPut = 0
+		return
+	}
+	f.failPut = f.puts + n
+}
+
+// DropWrites makes puts and deletes report success without reaching the
+// inner adapter.
+func (f *FaultyAdapter) DropWrites(drop bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.dropWrites = drop
+}
+
+// FlipReads makes Get return values with one bit flipped.
+func (f *FaultyAdapter) FlipReads(flip bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.flipReads = flip
+}
+
+// SetLatency delays every operation by d.
+func (f *FaultyAdapter) SetLatency(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.latency = d
+}
+
+// Puts returns the number of puts seen so far, including failed and dropped
+// ones.
+func (f *FaultyAdapter) Puts() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.puts
+}
+
+// delay sleeps for the configured latency.
+func (f *FaultyAdapter) delay() {
+	f.lock.Lock()
+	latency := f.latency
+	f.lock.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+}
+
+// countPuts records n puts and reports whether they must fail or be
+// dropped.
+func (f *FaultyAdapter) countPuts(n int) (fail bool, drop bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	first := f.puts + 1
+	f.puts += n
+	if f.failPut >= first && f.failPut <= f.puts {
+		f.failPut = 0
+		return true, false
+	}
+	return false, f.dropWrites
+}
+
+func (f *FaultyAdapter) Get(key []byte) ([]byte, error) {
+	f.delay()
+	value, err := f.inner.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	f.lock.Lock()
+	flip := f.flipReads
+	f.lock.Unlock()
+	if flip && len(value) > 0 {
+		value = append([]byte{}, value...)
+		value[len(value)/2] ^= 0x01
+	}
+	return value, nil
+}
+
+func (f *FaultyAdapter) Put(key, value []byte) error {
+	f.delay()
+	fail, drop := f.countPuts(1)
+	if fail {
+		return ErrInjected
+	} else if drop {
+		return nil
+	}
+	return f.inner.Put(key, value)
+}
+
+func (f *FaultyAdapter) Has(key []byte) bool {
+	f.delay()
+	return f.inner.Has(key)
+}
+
+// dropping reports whether writes are dropped.
+func (f *FaultyAdapter) dropping() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.dropWrites
+}
+
+func (f *FaultyAdapter) Delete(key []byte) error {
+	f.delay()
+	if f.dropping() {
+		return nil
+	}
+	return f.inner.Delete(key)
+}
+
+func (f *FaultyAdapter) BatchPut(kvs [][2][]byte) error {
+	f.delay()
+	fail, drop := f.countPuts(len(kvs))
+	if fail {
+		return ErrInjected
+	} else if drop {
+		return nil
+	}
+	return f.inner.BatchPut(kvs)
+}
+
+type faultyBatch struct {
+	batchOps
+	adapter *FaultyAdapter
+}
+
+// NewBatch returns a batch counting each of its puts when written. The puts
+// are queued in a batch of the inner adapter, which is only written once
+// all of them went through, so an injected failure in the middle of a batch
+// writes nothing.
+func (f *FaultyAdapter) NewBatch() Batch {
+	return &faultyBatch{adapter: f}
+}
+
+func (b *faultyBatch) Write() error {
+	b.adapter.delay()
+	batch := NewBatch(b.adapter.inner)
+	for _, op := range b.ops {
+		var err error
+		if op.delete {
+			if b.adapter.dropping() {
+				continue
+			}
+			err = batch.Delete(op.key)
+		} else {
+			fail, drop := b.adapter.countPuts(1)
+			if fail {
+				return ErrInjected
+			} else if drop {
+				continue
+			}
+			err = batch.Put(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+func (f *FaultyAdapter) Close() {
+	f.inner.Close()
+}
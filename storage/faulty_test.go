@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFaultyAdapter(t *testing.T) {
+	inner := NewMemoryAdapter()
+	store := NewFaultyAdapter(inner)
+
+	store.FailPut(3)
+	store.Put([]byte("key1"), []byte("value1"))
+	err := store.BatchPut([][2][]byte{
+		{[]byte("key2"), []byte("value2")},
+		{[]byte("key3"), []byte("value3")},
+	})
+	if !errors.Is(err, ErrInjected) {
+		t.Errorf("Expected ErrInjected, got %v", err)
+	}
+	if inner.Has([]byte("key2")) {
+		t.Error("Failed batch was partially written")
+	}
+	if err := store.Put([]byte("key2"), []byte("value2")); err != nil {
+		t.Errorf("Failure was injected twice: %v", err)
+	}
+	if store.Puts() != 4 {
+		t.Errorf("Expected 4 puts, got %d", store.Puts())
+	}
+
+	store.DropWrites(true)
+	store.Put([]byte("key4"), []byte("value4"))
+	store.Delete([]byte("key1"))
+	if inner.Has([]byte("key4")) || !inner.Has([]byte("key1")) {
+		t.Error("Writes were not dropped")
+	}
+	store.DropWrites(false)
+
+	store.FlipReads(true)
+	value, _ := store.Get([]byte("key1"))
+	if string(value) == "value1" {
+		t.Error("Read was not corrupted")
+	}
+	if stored, _ := inner.Get([]byte("key1")); string(stored) != "value1" {
+		t.Error("Corruption reached the inner adapter")
+	}
+	store.FlipReads(false)
+
+	store.SetLatency(10 * time.Millisecond)
+	start := time.Now()
+	store.Has([]byte("key1"))
+	if time.Since(start) < 10*time.Millisecond {
+		t.Error("Latency was not applied")
+	}
+}
+
+func TestFaultyBatch(t *testing.T) {
+	inner := NewMemoryAdapter()
+	inner.Put([]byte("key0"), []byte("value0"))
+	store := NewFaultyAdapter(inner)
+
+	batch := store.NewBatch()
+	batch.Put([]byte("key1"), []byte("value1"))
+	batch.Delete([]byte("key0"))
+	batch.Put([]byte("key2"), []byte("value2"))
+	batch.Put([]byte("key3"), []byte("value3"))
+	store.FailPut(2)
+	err := batch.Write()
+	if !errors.Is(err, ErrInjected) {
+		t.Errorf("Expected ErrInjected, got %v", err)
+	}
+	if store.Puts() != 2 {
+		t.Errorf("Expected the batch to fail at its second put, got %d puts", store.Puts())
+	}
+	if inner.Has([]byte("key1")) || !inner.Has([]byte("key0")) {
+		t.Error("Failed batch was partially written")
+	}
+
+	err = batch.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Puts() != 5 {
+		t.Errorf("Expected 5 puts, got %d", store.Puts())
+	}
+	if !inner.Has([]byte("key3")) || inner.Has([]byte("key0")) {
+		t.Error("Batch was not written")
+	}
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileLogAdapter stores key-value pairs in a single append-only file. Every
+// write appends a checksummed record and an in-memory index maps each live
+// key to its value in the file; deletes append a tombstone. The index is
+// rebuilt when the file is opened, and a torn record at the end of the file,
+// left by a crash during a write, is truncated away. Compact rewrites the
+// file with only the live keys.
+//
+// Single writes are not synced to disk; BatchPut and batch writes are, and
+// are applied atomically.
+type FileLogAdapter struct {
+	path  string
+	file  *os.File
+	index map[string]logEntry
+	size  int64
+	lock  *sync.RWMutex
+}
+
+// logEntry locates a value in the log file.
+type logEntry struct {
+	offset int64
+	length int
+}
+
+func NewFileLogAdapter(path string) (*FileLogAdapter, error) {
+	f := &FileLogAdapter{path: path, lock: &sync.RWMutex{}}
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file and rebuilds the index. A torn record at the end
+// of the file is truncated away; any corrupted record fails the open and
+// leaves the file untouched.
+func (f *FileLogAdapter) open() error {
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.index = make(map[string]logEntry)
+	f.size = 0
+
+	r := bufio.NewReader(file)
+	for {
+		record, err := readLogRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			err = f.apply(record, f.size)
+		}
+		if err == errTornRecord {
+			return f.truncate()
+		} else if err != nil {
+			file.Close()
+			return fmt.Errorf("[FileLog] Cannot open %s at offset %d: %w", f.path, f.size, err)
+		}
+		f.size += int64(logHeaderSize + len(record.key) + len(record.value))
+	}
+}
+
+func (f *FileLogAdapter) truncate() error {
+	err := f.file.Truncate(f.size)
+	if err == nil {
+		err = f.file.Sync()
+	}
+	if err != nil {
+		f.file.Close()
+		return fmt.Errorf("[FileLog] Cannot truncate torn record: %w", err)
+	}
+	return nil
+}
+
+// apply updates the index with a record written at offset.
+func (f *FileLogAdapter) apply(record logRecord, offset int64) error {
+	return replayLogRecord(record, func(kind byte, key, value []byte, valueOffset int64) {
+		if kind == recordDelete {
+			delete(f.index, string(key))
+			return
+		}
+		f.index[string(key)] = logEntry{offset + valueOffset, len(value)}
+	})
+}
+
+// append writes an encoded record at the end of the file and indexes it.
+func (f *FileLogAdapter) append(data []byte, sync bool) error {
+	_, err := f.file.WriteAt(data, f.size)
+	if err == nil && sync {
+		err = f.file.Sync()
+	}
+	if err != nil {
+		// drop whatever part of the record was written
+		f.file.Truncate(f.size)
+		return err
+	}
+	record, err := readLogRecord(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	err = f.apply(record, f.size)
+	f.size += int64(len(data))
+	return err
+}
+
+func (f *FileLogAdapter) Get(key []byte) ([]byte, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	entry, ok := f.index[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	value := make([]byte, entry.length)
+	_, err := f.file.ReadAt(value, entry.offset)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (f *FileLogAdapter) Put(key, value []byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.append(appendLogRecord(nil, recordPut, key, value), false)
+}
+
+func (f *FileLogAdapter) Has(key []byte) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	_, ok := f.index[string(key)]
+	return ok
+}
+
+func (f *FileLogAdapter) Delete(key []byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.index[string(key)]; !ok {
+		return fmt.Errorf("[FileLog] %w: %x", ErrNotFound, key)
+	}
+	return f.append(appendLogRecord(nil, recordDelete, key, nil), false)
+}
+
+func (f *FileLogAdapter) BatchPut(kvs [][2][]byte) error {
+	ops := make([]batchOp, len(kvs))
+	for i := range kvs {
+		ops[i] = batchOp{key: kvs[i][0], value: kvs[i][1]}
+	}
+	return f.writeBatch(ops)
+}
+
+func (f *FileLogAdapter) writeBatch(ops []batchOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.append(appendBatchRecord(nil, ops), true)
+}
+
+type fileLogBatch struct {
+	batchOps
+	adapter *FileLogAdapter
+}
+
+func (f *FileLogAdapter) NewBatch() Batch {
+	return &fileLogBatch{adapter: f}
+}
+
+func (b *fileLogBatch) Write() error {
+	return b.adapter.writeBatch(b.ops)
+}
+
+// NewIterator iterates over a copy of the matching pairs taken when it is
+// created.
+func (f *FileLogAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	var kvs [][2][]byte
+	for key, entry := range f.index {
+		if !hasPrefixFrom([]byte(key), prefix, start) {
+			continue
+		}
+		value := make([]byte, entry.length)
+		_, err := f.file.ReadAt(value, entry.offset)
+		if err != nil {
+			return &errorIterator{err}
+		}
+		kvs = append(kvs, [2][]byte{[]byte(key), value})
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i][0], kvs[j][0]) < 0
+	})
+	return &sliceIterator{kvs: kvs}
+}
+
+// Size returns the size of the log file in bytes.
+func (f *FileLogAdapter) Size() int64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.size
+}
+
+// Compact rewrites the log with a single record per live key, dropping
+// overwritten values and tombstones. The new log is written to a temporary
+// file that replaces the old one once synced, so a crash leaves either file
+// intact, and the adapter keeps using the old file if compaction fails.
+// Writes are blocked while compacting.
+func (f *FileLogAdapter) Compact() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	keys := make([]string, 0, len(f.index))
+	for key := range f.index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tmpPath := f.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	w := bufio.NewWriter(tmp)
+	index := make(map[string]logEntry, len(keys))
+	var size int64
+	var record []byte
+	for _, key := range keys {
+		entry := f.index[key]
+		value := make([]byte, entry.length)
+		_, err = f.file.ReadAt(value, entry.offset)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		record = appendLogRecord(record[:0], recordPut, []byte(key), value)
+		_, err = w.Write(record)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		index[key] = logEntry{size + int64(logHeaderSize+len(key)), len(value)}
+		size += int64(len(record))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, f.path)
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	// the open temporary file is now the log; switch to it before anything
+	// else can fail
+	f.file.Close()
+	f.file = tmp
+	f.index = index
+	f.size = size
+	return syncDir(filepath.Dir(f.path))
+}
+
+func (f *FileLogAdapter) Close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.file.Close()
+}
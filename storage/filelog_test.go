@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestFileLogAdapter(t *testing.T) *FileLogAdapter {
+	db, err := NewFileLogAdapter(filepath.Join(t.TempDir(), "trie.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestFileLogReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trie.log")
+	db, err := NewFileLogAdapter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("key1"), []byte("value1"))
+	db.BatchPut([][2][]byte{{[]byte("key2"), []byte("value2")}, {[]byte("key3"), []byte("value3")}})
+	db.Put([]byte("key1"), []byte("updated"))
+	db.Delete([]byte("key3"))
+	db.Close()
+
+	db, err = NewFileLogAdapter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for key, expected := range map[string]string{"key1": "updated", "key2": "value2"} {
+		value, err := db.Get([]byte(key))
+		if err != nil || string(value) != expected {
+			t.Errorf("Expected %s, got %s (err: %v)", expected, value, err)
+		}
+	}
+	if db.Has([]byte("key3")) {
+		t.Error("Deleted key is back after reopening")
+	}
+}
+
+func TestFileLogTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trie.log")
+	db, err := NewFileLogAdapter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("key1"), []byte("value1"))
+	size := db.Size()
+	db.BatchPut([][2][]byte{{[]byte("key2"), []byte("value2")}, {[]byte("key3"), []byte("value3")}})
+	db.Close()
+
+	// cut the batch record in the middle of its second operation
+	err = os.Truncate(path, size+40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewFileLogAdapter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Has([]byte("key1")) || db.Has([]byte("key2")) || db.Has([]byte("key3")) {
+		t.Error("Torn batch was partially applied")
+	}
+	if db.Size() != size {
+		t.Errorf("Expected size %d, got %d", size, db.Size())
+	}
+	db.Put([]byte("key4"), []byte("value4"))
+	db.Close()
+
+	db, err = NewFileLogAdapter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !db.Has([]byte("key4")) {
+		t.Error("Write after truncation was lost")
+	}
+}
+
+func TestFileLogCorruptedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trie.log")
+	db, err := NewFileLogAdapter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("key1"), []byte("value1"))
+	size := db.Size()
+	db.Put([]byte("key2"), []byte("value2"))
+	db.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a complete last record failing its checksum is not torn
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	_, err = NewFileLogAdapter(path)
+	if !errors.Is(err, errCorruptRecord) {
+		t.Errorf("Expected a corruption error, got %v", err)
+	}
+
+	// a record with a valid header is torn if its payload runs past the end
+	os.WriteFile(path, data[:len(data)-1], 0644)
+	db, err = NewFileLogAdapter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !db.Has([]byte("key1")) || db.Has([]byte("key2")) {
+		t.Error("Torn record was not dropped")
+	}
+	if db.Size() != size {
+		t.Errorf("Expected size %d, got %d", size, db.Size())
+	}
+}
+
+func TestFileLogCompact(t *testing.T) {
+	db := newTestFileLogAdapter(t)
+	for i := 0; i < 10; i++ {
+		db.Put([]byte("key1"), []byte{byte(i)})
+	}
+	db.Put([]byte("key2"), []byte("value2"))
+	db.Delete([]byte("key2"))
+	db.Put([]byte("key3"), []byte("value3"))
+	size := db.Size()
+
+	err := db.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Size() >= size {
+		t.Errorf("Expected compaction to shrink the log below %d, got %d", size, db.Size())
+	}
+	value, err := db.Get([]byte("key1"))
+	if err != nil || len(value) != 1 || value[0] != 9 {
+		t.Errorf("Expected [9], got %v (err: %v)", value, err)
+	}
+	if db.Has([]byte("key2")) || !db.Has([]byte("key3")) {
+		t.Error("Compaction changed the live keys")
+	}
+	if _, err := os.Stat(db.path + ".compact"); !os.IsNotExist(err) {
+		t.Error("Temporary compaction file was left behind")
+	}
+}
+
+func TestFileLogCorruptedMiddleRecord(t *testing.T) {
+	const recordSize = logHeaderSize + 4 + 6
+	for name, offset := range map[string]int{
+		// the last value byte of the second record
+		"value": 2*recordSize - 1,
+		// the low byte of the key length of the second record
+		"length": recordSize + 8,
+	} {
+		path := filepath.Join(t.TempDir(), "trie.log")
+		db, err := NewFileLogAdapter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Put([]byte("key1"), []byte("value1"))
+		db.Put([]byte("key2"), []byte("value2"))
+		db.Put([]byte("key3"), []byte("value3"))
+		db.Close()
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[offset] ^= 0x01
+		os.WriteFile(path, data, 0644)
+
+		_, err = NewFileLogAdapter(path)
+		if !errors.Is(err, errCorruptRecord) {
+			t.Errorf("%s: Expected a corruption error, got %v", name, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != int64(len(data)) {
+			t.Errorf("%s: Expected size %d, got %d", name, len(data), info.Size())
+		}
+	}
+}
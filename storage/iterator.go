@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+)
+
+// Iterator walks over key-value pairs in ascending key order. Key and Value
+// are only valid until the next call to Next.
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+	Release()
+}
+
+// Iteratee is implemented by adapters that can enumerate their keys.
+type Iteratee interface {
+	// NewIterator returns an iterator over the keys starting with prefix,
+	// beginning at prefix+start.
+	NewIterator(prefix []byte, start []byte) Iterator
+}
+
+type sliceIterator struct {
+	kvs   [][2][]byte
+	index int
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.index >= len(it.kvs) {
+		return false
+	}
+	it.index++
+	return true
+}
+
+func (it *sliceIterator) Key() []byte {
+	if it.index == 0 || it.index > len(it.kvs) {
+		return nil
+	}
+	return it.kvs[it.index-1][0]
+}
+
+func (it *sliceIterator) Value() []byte {
+	if it.index == 0 || it.index > len(it.kvs) {
+		return nil
+	}
+	return it.kvs[it.index-1][1]
+}
+
+func (it *sliceIterator) Error() error { return nil }
+
+func (it *sliceIterator) Release() { it.kvs = nil }
+
+// Export writes every key-value pair of src to w as a JSON object mapping
+// hex-encoded keys to values, the format read by MemoryAdapter.ImportSnapshot.
+func Export(src Iteratee, w io.Writer) error {
+	it := src.NewIterator(nil, nil)
+	defer it.Release()
+	_, err := io.WriteString(w, "{")
+	if err != nil {
+		return err
+	}
+	separator := ""
+	for it.Next() {
+		value, err := json.Marshal(it.Value())
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, separator+`"`+hex.EncodeToString(it.Key())+`":`+string(value))
+		if err != nil {
+			return err
+		}
+		separator = ","
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+// Import writes every key-value pair read from r in the format of Export to
+// dst in a single batch.
+func Import(dst StorageAdapter, r io.Reader) error {
+	data := make(map[string][]byte)
+	err := json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return err
+	}
+	kvs := make([][2][]byte, 0, len(data))
+	for keyHex, value := range data {
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return err
+		}
+		kvs = append(kvs, [2][]byte{key, value})
+	}
+	return dst.BatchPut(kvs)
+}
+
+func hasPrefixFrom(key, prefix, start []byte) bool {
+	return bytes.HasPrefix(key, prefix) && bytes.Compare(key[len(prefix):], start) >= 0
+}
+
+// decodingIterator decodes the values of an inner iterator, stopping at the
+// first value that cannot be decoded.
+type decodingIterator struct {
+	Iterator
+	decode func(key, data []byte) ([]byte, error)
+	value  []byte
+	err    error
+}
+
+func (it *decodingIterator) Next() bool {
+	if it.err != nil || !it.Iterator.Next() {
+		it.value = nil
+		return false
+	}
+	it.value, it.err = it.decode(it.Iterator.Key(), it.Iterator.Value())
+	return it.err == nil
+}
+
+func (it *decodingIterator) Value() []byte { return it.value }
+
+func (it *decodingIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.Iterator.Error()
+}
+
+// errorIterator is an empty iterator reporting an error.
+type errorIterator struct {
+	err error
+}
+
+func (it *errorIterator) Next() bool    { return false }
+func (it *errorIterator) Key() []byte   { return nil }
+func (it *errorIterator) Value() []byte { return nil }
+func (it *errorIterator) Error() error  { return it.err }
+func (it *errorIterator) Release()      {}
@@ -1,42 +1,227 @@
 package storage
 
-import "github.com/syndtr/goleveldb/leveldb"
+import (
+	"context"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
 
 type LevelDBAdapter struct {
-	backend *leveldb.DB
+	backend      *leveldb.DB
+	writeOptions *opt.WriteOptions
+}
+
+// LevelDBOptions tunes a LevelDBAdapter. Zero values keep the goleveldb
+// defaults.
+type LevelDBOptions struct {
+	// BlockCacheCapacity is the size of the block cache in bytes.
+	BlockCacheCapacity int
+	// WriteBuffer is the size of the memtable in bytes.
+	WriteBuffer int
+	// BloomFilterBits enables a bloom filter with the given bits per key.
+	BloomFilterBits int
+	// DisableCompression stores tables without snappy compression.
+	DisableCompression bool
+	// ReadOnly opens the database without write access.
+	ReadOnly bool
+	// Sync flushes every write, including single puts and deletes, to disk
+	// before returning.
+	Sync bool
+	// Recover rebuilds the manifest of a corrupted database on open.
+	Recover bool
 }
 
 func NewLevelDBAdapter(path string) (*LevelDBAdapter, error) {
-	backend, err := leveldb.OpenFile(path, nil)
+	return NewLevelDBAdapterWithOptions(path, nil)
+}
+
+func NewLevelDBAdapterWithOptions(path string, opts *LevelDBOptions) (*LevelDBAdapter, error) {
+	if opts == nil {
+		opts = &LevelDBOptions{}
+	}
+	o := &opt.Options{
+		BlockCacheCapacity: opts.BlockCacheCapacity,
+		WriteBuffer:        opts.WriteBuffer,
+		ReadOnly:           opts.ReadOnly,
+	}
+	if opts.BloomFilterBits > 0 {
+		o.Filter = filter.NewBloomFilter(opts.BloomFilterBits)
+	}
+	if opts.DisableCompression {
+		o.Compression = opt.NoCompression
+	}
+	backend, err := leveldb.OpenFile(path, o)
+	if errors.IsCorrupted(err) && opts.Recover {
+		backend, err = leveldb.RecoverFile(path, o)
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &LevelDBAdapter{backend}, nil
+	return &LevelDBAdapter{backend, &opt.WriteOptions{Sync: opts.Sync}}, nil
 }
 
 func (db *LevelDBAdapter) Get(key []byte) ([]byte, error) {
-	return db.backend.Get(key, nil)
+	return db.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get but fails without reading if ctx is done. goleveldb
+// operations cannot be interrupted once started; the other context methods
+// likewise check ctx before calling the backend.
+func (db *LevelDBAdapter) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	value, err := db.backend.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return value, err
 }
 
 func (db *LevelDBAdapter) Put(key, value []byte) error {
-	return db.backend.Put(key, value, nil)
+	return db.PutContext(context.Background(), key, value)
+}
+
+func (db *LevelDBAdapter) PutContext(ctx context.Context, key, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return db.backend.Put(key, value, db.writeOptions)
 }
 
 func (db *LevelDBAdapter) Has(key []byte) bool {
-	has, _ := db.backend.Has(key, nil)
+	has, _ := db.HasContext(context.Background(), key)
 	return has
 }
 
+func (db *LevelDBAdapter) HasContext(ctx context.Context, key []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return db.backend.Has(key, nil)
+}
+
 func (db *LevelDBAdapter) Delete(key []byte) error {
-	return db.backend.Delete(key, nil)
+	return db.DeleteContext(context.Background(), key)
+}
+
+func (db *LevelDBAdapter) DeleteContext(ctx context.Context, key []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return db.backend.Delete(key, db.writeOptions)
 }
 
 func (db *LevelDBAdapter) BatchPut(kvs [][2][]byte) error {
+	return db.BatchPutContext(context.Background(), kvs)
+}
+
+// BatchPutContext is like BatchPut but also gives up if ctx is done while
+// the batch is built.
+func (db *LevelDBAdapter) BatchPutContext(ctx context.Context, kvs [][2][]byte) error {
 	batch := new(leveldb.Batch)
 	for i := range kvs {
+		if i%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
 		batch.Put(kvs[i][0], kvs[i][1])
 	}
-	return db.backend.Write(batch, nil)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return db.backend.Write(batch, db.writeOptions)
+}
+
+type levelDBBatch struct {
+	db    *LevelDBAdapter
+	batch *leveldb.Batch
+	size  int
+}
+
+func (db *LevelDBAdapter) NewBatch() Batch {
+	return &levelDBBatch{db: db, batch: new(leveldb.Batch)}
+}
+
+func (b *levelDBBatch) Put(key, value []byte) error {
+	b.batch.Put(key, value)
+	b.size += len(key) + len(value)
+	return nil
+}
+
+func (b *levelDBBatch) Delete(key []byte) error {
+	b.batch.Delete(key)
+	b.size += len(key)
+	return nil
+}
+
+func (b *levelDBBatch) ValueSize() int { return b.size }
+
+func (b *levelDBBatch) Write() error {
+	return b.db.backend.Write(b.batch, b.db.writeOptions)
+}
+
+func (b *levelDBBatch) Reset() {
+	b.batch.Reset()
+	b.size = 0
+}
+
+func (b *levelDBBatch) Replay(w KeyValueWriter) error {
+	r := &levelDBReplayer{w: w}
+	if err := b.batch.Replay(r); err != nil {
+		return err
+	}
+	return r.err
+}
+
+// levelDBReplayer adapts a KeyValueWriter to leveldb.BatchReplay, keeping
+// the first error.
+type levelDBReplayer struct {
+	w   KeyValueWriter
+	err error
+}
+
+func (r *levelDBReplayer) Put(key, value []byte) {
+	if r.err == nil {
+		r.err = r.w.Put(key, value)
+	}
+}
+
+func (r *levelDBReplayer) Delete(key []byte) {
+	if r.err == nil {
+		r.err = r.w.Delete(key)
+	}
+}
+
+func (db *LevelDBAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	r := util.BytesPrefix(prefix)
+	r.Start = append(append([]byte{}, prefix...), start...)
+	return db.backend.NewIterator(r, nil)
+}
+
+// CompactRange compacts the keys in [start, limit). Nil bounds extend the
+// range to the first or last key.
+func (db *LevelDBAdapter) CompactRange(start, limit []byte) error {
+	return db.backend.CompactRange(util.Range{Start: start, Limit: limit})
+}
+
+// Stats returns the statistics of the database, such as its level sizes,
+// compaction times and I/O counters.
+func (db *LevelDBAdapter) Stats() (*leveldb.DBStats, error) {
+	stats := &leveldb.DBStats{}
+	err := db.backend.Stats(stats)
+	return stats, err
+}
+
+// Property returns a leveldb property such as "leveldb.stats" or
+// "leveldb.num-files-at-level0".
+func (db *LevelDBAdapter) Property(name string) (string, error) {
+	return db.backend.GetProperty(name)
 }
 
 func (db *LevelDBAdapter) Close() {
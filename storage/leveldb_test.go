@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLevelDBOptions(t *testing.T) {
+	dir, err := os.MkdirTemp("", "leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewLevelDBAdapterWithOptions(dir, &LevelDBOptions{
+		BlockCacheCapacity: 1 << 20,
+		WriteBuffer:        1 << 20,
+		BloomFilterBits:    10,
+		DisableCompression: true,
+		Sync:               true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.BatchPut([][2][]byte{{[]byte("key1"), []byte("value1")}, {[]byte("key2"), []byte("value2")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// single writes are synced as well
+	err = db.Put([]byte("key3"), []byte("value3"))
+	if err == nil {
+		err = db.Delete([]byte("key3"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CompactRange(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats()
+	if err != nil || len(stats.LevelTablesCounts) == 0 {
+		t.Errorf("Unexpected stats %+v (err: %v)", stats, err)
+	}
+	property, err := db.Property("leveldb.stats")
+	if err != nil || property == "" {
+		t.Errorf("Unexpected property %q (err: %v)", property, err)
+	}
+	db.Close()
+
+	db, err = NewLevelDBAdapterWithOptions(dir, &LevelDBOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := db.Get([]byte("key1"))
+	if err != nil || string(value) != "value1" {
+		t.Errorf("Expected value1, got %s (err: %v)", value, err)
+	}
+	if db.Put([]byte("key3"), []byte("value3")) == nil {
+		t.Error("Expected error writing to a read-only database")
+	}
+	db.Close()
+
+	manifests, _ := filepath.Glob(filepath.Join(dir, "MANIFEST-*"))
+	for _, manifest := range manifests {
+		os.Remove(manifest)
+	}
+	_, err = NewLevelDBAdapter(dir)
+	if err == nil {
+		t.Fatal("Expected error opening a database without manifest")
+	}
+	db, err = NewLevelDBAdapterWithOptions(dir, &LevelDBOptions{Recover: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value, err = db.Get([]byte("key2"))
+	if err != nil || string(value) != "value2" {
+		t.Errorf("Expected value2 after recovery, got %s (err: %v)", value, err)
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Log records are encoded as
+//
+//	header crc (4) | kind (1) | key length (4) | value length (4) | data crc (4) | key | value
+//
+// with big-endian integers and Castagnoli CRCs. The header CRC covers the
+// kind, the lengths and the data CRC, so that a corrupted length is caught
+// before it is used; the data CRC covers the key and the value. A batch
+// record has no key; its value is the sequence of put and delete records of
+// the batch, so that a batch is written and verified as a whole.
+const (
+	recordPut byte = iota + 1
+	recordDelete
+	recordBatch
+)
+
+const logHeaderSize = 17
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// errTornRecord reports a record with a valid header running past the
+	// end of the log, as left by a crash during a write.
+	errTornRecord = errors.New("torn log record")
+	// errCorruptRecord reports a record that does not match its checksums or
+	// cannot be decoded.
+	errCorruptRecord = errors.New("corrupted log record")
+)
+
+type logRecord struct {
+	kind  byte
+	key   []byte
+	value []byte
+}
+
+func appendLogRecord(buf []byte, kind byte, key, value []byte) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0, kind)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(key)))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+	crc := crc32.Update(crc32.Checksum(key, crcTable), crcTable, value)
+	buf = binary.BigEndian.AppendUint32(buf, crc)
+	binary.BigEndian.PutUint32(buf[start:], crc32.Checksum(buf[start+4:], crcTable))
+	buf = append(buf, key...)
+	return append(buf, value...)
+}
+
+// appendBatchRecord encodes the operations of a batch as a single record.
+func appendBatchRecord(buf []byte, ops []batchOp) []byte {
+	var payload []byte
+	for _, op := range ops {
+		if op.delete {
+			payload = appendLogRecord(payload, recordDelete, op.key, nil)
+		} else {
+			payload = appendLogRecord(payload, recordPut, op.key, op.value)
+		}
+	}
+	return appendLogRecord(buf, recordBatch, nil, payload)
+}
+
+// readLogRecord reads the next record of r. It returns io.EOF at the end of
+// r, errTornRecord if r ends within the record and errCorruptRecord if the
+// record is invalid. Only a record whose header is intact can be torn.
+func readLogRecord(r io.Reader) (logRecord, error) {
+	header := make([]byte, logHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return logRecord{}, io.EOF
+	} else if err != nil {
+		return logRecord{}, errTornRecord
+	}
+	kind := header[4]
+	if crc32.Checksum(header[4:], crcTable) != binary.BigEndian.Uint32(header) ||
+		kind < recordPut || kind > recordBatch {
+		return logRecord{}, errCorruptRecord
+	}
+	keyLen := binary.BigEndian.Uint32(header[5:])
+	valueLen := binary.BigEndian.Uint32(header[9:])
+	size := int64(keyLen) + int64(valueLen)
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil || int64(len(data)) != size {
+		return logRecord{}, errTornRecord
+	}
+	if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(header[13:]) {
+		return logRecord{}, errCorruptRecord
+	}
+	return logRecord{kind, data[:keyLen], data[keyLen:]}, nil
+}
+
+// replayLogRecord calls fn for every put and delete of a record, with the
+// offset of the value relative to the start of the record. Batch records
+// are expanded into their operations.
+func replayLogRecord(record logRecord, fn func(kind byte, key, value []byte, offset int64)) error {
+	if record.kind != recordBatch {
+		fn(record.kind, record.key, record.value, int64(logHeaderSize+len(record.key)))
+		return nil
+	}
+	r := bytes.NewReader(record.value)
+	for r.Len() > 0 {
+		start := int64(logHeaderSize) + r.Size() - int64(r.Len())
+		op, err := readLogRecord(r)
+		if err != nil || op.kind == recordBatch {
+			return errCorruptRecord
+		}
+		fn(op.kind, op.key, op.value, start+int64(logHeaderSize+len(op.key)))
+	}
+	return nil
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -1,9 +1,10 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -15,6 +16,7 @@ import (
 type MemoryAdapter struct {
 	store map[string][]byte
 	lock  *sync.RWMutex
+	wal   *memoryWAL
 }
 
 func NewMemoryAdapter() *MemoryAdapter {
@@ -25,58 +27,177 @@ func NewMemoryAdapter() *MemoryAdapter {
 }
 
 func (kv *MemoryAdapter) Get(key []byte) ([]byte, error) {
+	return kv.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get but fails if ctx is done once the lock is acquired.
+// The other context methods behave the same way.
+func (kv *MemoryAdapter) GetContext(ctx context.Context, key []byte) ([]byte, error) {
 	kv.lock.RLock()
 	defer kv.lock.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	keyHex := hex.EncodeToString(key)
 	if v, ok := kv.store[keyHex]; ok {
-		return v, nil
+		return append([]byte{}, v...), nil
 	}
-	return nil, errors.New("key not found")
+	return nil, ErrNotFound
 }
 
 func (kv *MemoryAdapter) Put(key, value []byte) error {
+	return kv.PutContext(context.Background(), key, value)
+}
+
+func (kv *MemoryAdapter) PutContext(ctx context.Context, key, value []byte) error {
 	kv.lock.Lock()
 	defer kv.lock.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if kv.wal != nil {
+		err := kv.logWrite(appendLogRecord(nil, recordPut, key, value))
+		if err != nil {
+			return err
+		}
+	}
 	keyHex := hex.EncodeToString(key)
-	kv.store[keyHex] = value
+	kv.store[keyHex] = append([]byte{}, value...)
+	if kv.wal != nil {
+		kv.maybeCheckpoint()
+	}
 	return nil
 }
 
 func (kv *MemoryAdapter) Has(key []byte) bool {
+	has, _ := kv.HasContext(context.Background(), key)
+	return has
+}
+
+func (kv *MemoryAdapter) HasContext(ctx context.Context, key []byte) (bool, error) {
 	kv.lock.RLock()
 	defer kv.lock.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	keyHex := hex.EncodeToString(key)
 	_, ok := kv.store[keyHex]
-	return ok
+	return ok, nil
 }
 
 func (kv *MemoryAdapter) Delete(key []byte) error {
+	return kv.DeleteContext(context.Background(), key)
+}
+
+func (kv *MemoryAdapter) DeleteContext(ctx context.Context, key []byte) error {
 	kv.lock.Lock()
 	defer kv.lock.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	keyHex := hex.EncodeToString(key)
-	if _, ok := kv.store[keyHex]; ok {
-		delete(kv.store, keyHex)
-	} else {
-		return fmt.Errorf("[MemKV] key not found: %s", keyHex)
+	if _, ok := kv.store[keyHex]; !ok {
+		return fmt.Errorf("[MemKV] %w: %s", ErrNotFound, keyHex)
+	}
+	if kv.wal != nil {
+		err := kv.logWrite(appendLogRecord(nil, recordDelete, key, nil))
+		if err != nil {
+			return err
+		}
+	}
+	delete(kv.store, keyHex)
+	if kv.wal != nil {
+		kv.maybeCheckpoint()
 	}
 	return nil
 }
 
 func (kv *MemoryAdapter) BatchPut(kvs [][2][]byte) error {
+	return kv.BatchPutContext(context.Background(), kvs)
+}
+
+func (kv *MemoryAdapter) BatchPutContext(ctx context.Context, kvs [][2][]byte) error {
 	log.Println("BatchPut: Acquiring lock")
 	kv.lock.Lock()
 	defer kv.lock.Unlock()
 	log.Println("BatchPut: Lock acquired")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if kv.wal != nil {
+		ops := make([]batchOp, len(kvs))
+		for i := range kvs {
+			ops[i] = batchOp{key: kvs[i][0], value: kvs[i][1]}
+		}
+		err := kv.logWrite(appendBatchRecord(nil, ops))
+		if err != nil {
+			return err
+		}
+	}
 
 	for _, kvp := range kvs {
 		keyHex := hex.EncodeToString(kvp[0])
-		kv.store[keyHex] = kvp[1]
+		kv.store[keyHex] = append([]byte{}, kvp[1]...)
 		log.Printf("BatchPut: Stored key %s", keyHex)
 	}
 	log.Println("BatchPut: Completed")
+	if kv.wal != nil {
+		kv.maybeCheckpoint()
+	}
+	return nil
+}
+
+type memoryBatch struct {
+	batchOps
+	kv *MemoryAdapter
+}
+
+func (kv *MemoryAdapter) NewBatch() Batch {
+	return &memoryBatch{kv: kv}
+}
+
+func (b *memoryBatch) Write() error {
+	b.kv.lock.Lock()
+	defer b.kv.lock.Unlock()
+	if b.kv.wal != nil && len(b.ops) > 0 {
+		err := b.kv.logWrite(appendBatchRecord(nil, b.ops))
+		if err != nil {
+			return err
+		}
+	}
+	for _, op := range b.ops {
+		keyHex := hex.EncodeToString(op.key)
+		if op.delete {
+			delete(b.kv.store, keyHex)
+		} else {
+			b.kv.store[keyHex] = op.value
+		}
+	}
+	if b.kv.wal != nil {
+		b.kv.maybeCheckpoint()
+	}
 	return nil
 }
 
+// NewIterator returns an iterator over a sorted copy of the matching keys.
+func (kv *MemoryAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+
+	var kvs [][2][]byte
+	for keyHex, value := range kv.store {
+		key, _ := hex.DecodeString(keyHex)
+		if hasPrefixFrom(key, prefix, start) {
+			kvs = append(kvs, [2][]byte{key, append([]byte{}, value...)})
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i][0], kvs[j][0]) < 0
+	})
+	return &sliceIterator{kvs: kvs}
+}
+
 func (kv *MemoryAdapter) CreateSnapshot() map[string][]byte {
 	kv.lock.RLock()
 	defer kv.lock.RUnlock()
@@ -89,20 +210,13 @@ func (kv *MemoryAdapter) CreateSnapshot() map[string][]byte {
 }
 
 func (kv *MemoryAdapter) ExportSnapshot(filename string) error {
-	snapshot := kv.CreateSnapshot()
-	data, err := json.Marshal(snapshot)
-	if err != nil {
-		return err
-	}
-
 	file, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	_, err = file.Write(data)
-	return err
+	return Export(kv, file)
 }
 
 func (kv *MemoryAdapter) ImportSnapshot(filename string) error {
@@ -122,6 +236,9 @@ func (kv *MemoryAdapter) ImportSnapshot(filename string) error {
 	kv.lock.Lock()
 	defer kv.lock.Unlock()
 	kv.store = data
+	if kv.wal != nil {
+		return kv.checkpoint()
+	}
 	return nil
 }
 
@@ -152,4 +269,9 @@ func (kv *MemoryAdapter) PruneOldSnapshots(directory string, maxSnapshots int) e
 	return nil
 }
 
-func (kv *MemoryAdapter) Close() {}
+// Close closes the write-ahead log, if any. The pairs stay readable.
+func (kv *MemoryAdapter) Close() {
+	if kv.wal != nil {
+		kv.wal.file.Close()
+	}
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"bytes"
+	"errors"
 	"log"
 	"os"
 	"testing"
@@ -104,3 +106,69 @@ func TestGet(t *testing.T) {
 		t.Fatalf("Expected value1, got %s (err: %v)", string(value), err)
 	}
 }
+
+func TestNotFound(t *testing.T) {
+	kv := NewMemoryAdapter()
+	_, err := kv.Get([]byte("missing"))
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	err = kv.Delete([]byte("missing"))
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestIterator(t *testing.T) {
+	kv := NewMemoryAdapter()
+	for _, key := range []string{"b2", "a1", "b1", "b3", "c1"} {
+		kv.Put([]byte(key), []byte("v"+key))
+	}
+	var keys []string
+	it := kv.NewIterator([]byte("b"), []byte("2"))
+	for it.Next() {
+		if string(it.Value()) != "v"+string(it.Key()) {
+			t.Errorf("Unexpected value %s for key %s", it.Value(), it.Key())
+		}
+		keys = append(keys, string(it.Key()))
+		it.Value()[0] = 'X'
+	}
+	it.Release()
+	if len(keys) != 2 || keys[0] != "b2" || keys[1] != "b3" {
+		t.Fatalf("Expected [b2 b3], got %v", keys)
+	}
+	value, _ := kv.Get([]byte("b2"))
+	if string(value) != "vb2" {
+		t.Errorf("Iterator value is shared with the store, got %s", value)
+	}
+}
+
+func TestExportImportLevelDB(t *testing.T) {
+	dir, err := os.MkdirTemp("", "leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := NewLevelDBAdapter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put([]byte("key1"), []byte("value1"))
+	db.Put([]byte("key2"), []byte("value2"))
+
+	var buf bytes.Buffer
+	err = Export(db, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv := NewMemoryAdapter()
+	err = Import(kv, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := kv.Get([]byte("key2"))
+	if err != nil || string(value) != "value2" {
+		t.Fatalf("Expected value2, got %s (err: %v)", string(value), err)
+	}
+}
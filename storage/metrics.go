@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MetricsSink receives one observation per storage operation.
+type MetricsSink interface {
+	Observe(method string, bytesRead, bytesWritten int, latency time.Duration, err error)
+}
+
+// MetricsAdapter reports every operation of an inner adapter to a sink.
+type MetricsAdapter struct {
+	inner StorageAdapter
+	sink  MetricsSink
+}
+
+func NewMetricsAdapter(inner StorageAdapter, sink MetricsSink) *MetricsAdapter {
+	return &MetricsAdapter{
+		inner: inner,
+		sink:  sink,
+	}
+}
+
+func (m *MetricsAdapter) Get(key []byte) ([]byte, error) {
+	return m.GetContext(context.Background(), key)
+}
+
+func (m *MetricsAdapter) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	start := time.Now()
+	value, err := GetContext(ctx, m.inner, key)
+	m.sink.Observe("Get", len(value), 0, time.Since(start), err)
+	return value, err
+}
+
+func (m *MetricsAdapter) Put(key, value []byte) error {
+	return m.PutContext(context.Background(), key, value)
+}
+
+func (m *MetricsAdapter) PutContext(ctx context.Context, key, value []byte) error {
+	start := time.Now()
+	err := PutContext(ctx, m.inner, key, value)
+	m.sink.Observe("Put", 0, len(key)+len(value), time.Since(start), err)
+	return err
+}
+
+func (m *MetricsAdapter) Has(key []byte) bool {
+	has, _ := m.HasContext(context.Background(), key)
+	return has
+}
+
+func (m *MetricsAdapter) HasContext(ctx context.Context, key []byte) (bool, error) {
+	start := time.Now()
+	has, err := HasContext(ctx, m.inner, key)
+	m.sink.Observe("Has", 0, 0, time.Since(start), err)
+	return has, err
+}
+
+func (m *MetricsAdapter) Delete(key []byte) error {
+	return m.DeleteContext(context.Background(), key)
+}
+
+func (m *MetricsAdapter) DeleteContext(ctx context.Context, key []byte) error {
+	start := time.Now()
+	err := DeleteContext(ctx, m.inner, key)
+	m.sink.Observe("Delete", 0, 0, time.Since(start), err)
+	return err
+}
+
+func (m *MetricsAdapter) BatchPut(kvs [][2][]byte) error {
+	return m.BatchPutContext(context.Background(), kvs)
+}
+
+func (m *MetricsAdapter) BatchPutContext(ctx context.Context, kvs [][2][]byte) error {
+	size := 0
+	for _, kvp := range kvs {
+		size += len(kvp[0]) + len(kvp[1])
+	}
+	start := time.Now()
+	err := BatchPutContext(ctx, m.inner, kvs)
+	m.sink.Observe("BatchPut", 0, size, time.Since(start), err)
+	return err
+}
+
+type metricsBatch struct {
+	Batch
+	sink MetricsSink
+}
+
+// NewBatch returns a batch of the inner adapter whose writes are reported
+// as "BatchWrite".
+func (m *MetricsAdapter) NewBatch() Batch {
+	return &metricsBatch{NewBatch(m.inner), m.sink}
+}
+
+func (b *metricsBatch) Write() error {
+	start := time.Now()
+	err := b.Batch.Write()
+	b.sink.Observe("BatchWrite", 0, b.ValueSize(), time.Since(start), err)
+	return err
+}
+
+// NewIterator iterates over the inner adapter. Iterations are not reported.
+func (m *MetricsAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	iteratee, ok := m.inner.(Iteratee)
+	if !ok {
+		return &errorIterator{errors.New("[Metrics] inner adapter cannot be iterated")}
+	}
+	return iteratee.NewIterator(prefix, start)
+}
+
+func (m *MetricsAdapter) Close() {
+	m.inner.Close()
+}
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram
+// buckets used by Metrics.
+var DefaultLatencyBuckets = []time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// MethodMetrics aggregates the observations of one method. Buckets holds
+// the number of calls per latency bucket, the last one counting calls slower
+// than every bound.
+type MethodMetrics struct {
+	Calls        uint64
+	Errors       uint64
+	BytesRead    uint64
+	BytesWritten uint64
+	LatencySum   time.Duration
+	Buckets      []uint64
+}
+
+// Metrics is a MetricsSink aggregating observations per method in memory.
+// It can be published through expvar or written in the Prometheus text
+// format.
+type Metrics struct {
+	bounds  []time.Duration
+	methods map[string]*MethodMetrics
+	lock    *sync.Mutex
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		bounds:  DefaultLatencyBuckets,
+		methods: make(map[string]*MethodMetrics),
+		lock:    &sync.Mutex{},
+	}
+}
+
+func (m *Metrics) Observe(method string, bytesRead, bytesWritten int, latency time.Duration, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	metrics, ok := m.methods[method]
+	if !ok {
+		metrics = &MethodMetrics{Buckets: make([]uint64, len(m.bounds)+1)}
+		m.methods[method] = metrics
+	}
+	metrics.Calls++
+	if err != nil {
+		metrics.Errors++
+	}
+	metrics.BytesRead += uint64(bytesRead)
+	metrics.BytesWritten += uint64(bytesWritten)
+	metrics.LatencySum += latency
+	bucket := sort.Search(len(m.bounds), func(i int) bool { return latency <= m.bounds[i] })
+	metrics.Buckets[bucket]++
+}
+
+// Snapshot returns a copy of the metrics of every observed method.
+func (m *Metrics) Snapshot() map[string]MethodMetrics {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	snapshot := make(map[string]MethodMetrics, len(m.methods))
+	for method, metrics := range m.methods {
+		copied := *metrics
+		copied.Buckets = append([]uint64{}, metrics.Buckets...)
+		snapshot[method] = copied
+	}
+	return snapshot
+}
+
+// Expvar returns a variable exposing Snapshot, to be registered with
+// expvar.Publish.
+func (m *Metrics) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} { return m.Snapshot() })
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition
+// format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	snapshot := m.Snapshot()
+	methods := make([]string, 0, len(snapshot))
+	for method := range snapshot {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(MethodMetrics) uint64
+	}{
+		{"mpt_storage_operations_total", "Number of storage operations.", func(mm MethodMetrics) uint64 { return mm.Calls }},
+		{"mpt_storage_errors_total", "Number of failed storage operations.", func(mm MethodMetrics) uint64 { return mm.Errors }},
+		{"mpt_storage_read_bytes_total", "Number of bytes read from storage.", func(mm MethodMetrics) uint64 { return mm.BytesRead }},
+		{"mpt_storage_written_bytes_total", "Number of bytes written to storage.", func(mm MethodMetrics) uint64 { return mm.BytesWritten }},
+	}
+	for _, counter := range counters {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			_, err = fmt.Fprintf(w, "%s{method=%q} %d\n", counter.name, method, counter.value(snapshot[method]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	const name = "mpt_storage_latency_seconds"
+	_, err := fmt.Fprintf(w, "# HELP %s Latency of storage operations.\n# TYPE %s histogram\n", name, name)
+	if err != nil {
+		return err
+	}
+	for _, method := range methods {
+		metrics := snapshot[method]
+		var cumulative uint64
+		for i, count := range metrics.Buckets {
+			cumulative += count
+			le := "+Inf"
+			if i < len(m.bounds) {
+				le = strconv.FormatFloat(m.bounds[i].Seconds(), 'g', -1, 64)
+			}
+			_, err = fmt.Fprintf(w, "%s_bucket{method=%q,le=%q} %d\n", name, method, le, cumulative)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(w, "%s_sum{method=%q} %g\n%s_count{method=%q} %d\n",
+			name, method, metrics.LatencySum.Seconds(), name, method, metrics.Calls)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMetricsAdapter(t *testing.T) {
+	metrics := NewMetrics()
+	store := NewMetricsAdapter(NewMemoryAdapter(), metrics)
+	store.Put([]byte("key1"), []byte("value1"))
+	store.Get([]byte("key1"))
+	store.Get([]byte("missing"))
+	store.Has([]byte("key1"))
+	batch := store.NewBatch()
+	batch.Put([]byte("key2"), []byte("value2"))
+	batch.Write()
+
+	snapshot := metrics.Snapshot()
+	if get := snapshot["Get"]; get.Calls != 2 || get.Errors != 1 || get.BytesRead != 6 {
+		t.Errorf("Unexpected Get metrics %+v", get)
+	}
+	if put := snapshot["Put"]; put.Calls != 1 || put.BytesWritten != 10 {
+		t.Errorf("Unexpected Put metrics %+v", put)
+	}
+	if write := snapshot["BatchWrite"]; write.Calls != 1 || write.BytesWritten != 10 {
+		t.Errorf("Unexpected BatchWrite metrics %+v", write)
+	}
+
+	var buf bytes.Buffer
+	err := metrics.WritePrometheus(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`mpt_storage_operations_total{method="Get"} 2`,
+		`mpt_storage_errors_total{method="Get"} 1`,
+		`mpt_storage_latency_seconds_bucket{method="Has",le="+Inf"} 1`,
+		`mpt_storage_latency_seconds_count{method="Put"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Missing %q in:\n%s", line, buf.String())
+		}
+	}
+
+	it := NewMetricsAdapter(plainAdapter{NewMemoryAdapter()}, metrics).NewIterator(nil, nil)
+	if it.Next() || it.Error() == nil {
+		t.Error("Expected iteration error for a non-iterable inner adapter")
+	}
+
+	exported := make(map[string]MethodMetrics)
+	err = json.Unmarshal([]byte(metrics.Expvar().String()), &exported)
+	if err != nil || exported["Get"].Calls != 2 {
+		t.Errorf("Unexpected expvar output %s (err: %v)", metrics.Expvar().String(), err)
+	}
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// OverlayAdapter buffers writes and deletes in memory on top of a parent
+// adapter, which is only read from until Flush. Overlays can be stacked.
+type OverlayAdapter struct {
+	parent  StorageAdapter
+	entries map[string]overlayEntry
+	lock    *sync.RWMutex
+}
+
+type overlayEntry struct {
+	value   []byte
+	deleted bool
+}
+
+func NewOverlayAdapter(parent StorageAdapter) *OverlayAdapter {
+	return &OverlayAdapter{
+		parent:  parent,
+		entries: make(map[string]overlayEntry),
+		lock:    &sync.RWMutex{},
+	}
+}
+
+func (o *OverlayAdapter) Get(key []byte) ([]byte, error) {
+	return o.GetContext(context.Background(), key)
+}
+
+// GetContext forwards ctx to the parent for keys that are not buffered, as
+// does HasContext. Buffered writes only fail if ctx is already done.
+func (o *OverlayAdapter) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if entry, ok := o.entries[string(key)]; ok {
+		if entry.deleted {
+			return nil, ErrNotFound
+		}
+		return append([]byte{}, entry.value...), nil
+	}
+	return GetContext(ctx, o.parent, key)
+}
+
+func (o *OverlayAdapter) Put(key, value []byte) error {
+	return o.PutContext(context.Background(), key, value)
+}
+
+func (o *OverlayAdapter) PutContext(ctx context.Context, key, value []byte) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	o.entries[string(key)] = overlayEntry{value: append([]byte{}, value...)}
+	return nil
+}
+
+func (o *OverlayAdapter) Has(key []byte) bool {
+	has, _ := o.HasContext(context.Background(), key)
+	return has
+}
+
+func (o *OverlayAdapter) HasContext(ctx context.Context, key []byte) (bool, error) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	return o.has(ctx, key)
+}
+
+func (o *OverlayAdapter) has(ctx context.Context, key []byte) (bool, error) {
+	if entry, ok := o.entries[string(key)]; ok {
+		return !entry.deleted, nil
+	}
+	return HasContext(ctx, o.parent, key)
+}
+
+func (o *OverlayAdapter) Delete(key []byte) error {
+	return o.DeleteContext(context.Background(), key)
+}
+
+func (o *OverlayAdapter) DeleteContext(ctx context.Context, key []byte) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	has, err := o.has(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return fmt.Errorf("[Overlay] %w: %x", ErrNotFound, key)
+	}
+	o.entries[string(key)] = overlayEntry{deleted: true}
+	return nil
+}
+
+func (o *OverlayAdapter) BatchPut(kvs [][2][]byte) error {
+	return o.BatchPutContext(context.Background(), kvs)
+}
+
+func (o *OverlayAdapter) BatchPutContext(ctx context.Context, kvs [][2][]byte) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, kvp := range kvs {
+		o.entries[string(kvp[0])] = overlayEntry{value: append([]byte{}, kvp[1]...)}
+	}
+	return nil
+}
+
+type overlayBatch struct {
+	batchOps
+	overlay *OverlayAdapter
+}
+
+func (o *OverlayAdapter) NewBatch() Batch {
+	return &overlayBatch{overlay: o}
+}
+
+func (b *overlayBatch) Write() error {
+	b.overlay.lock.Lock()
+	defer b.overlay.lock.Unlock()
+	for _, op := range b.ops {
+		b.overlay.entries[string(op.key)] = overlayEntry{value: op.value, deleted: op.delete}
+	}
+	return nil
+}
+
+// NewIterator iterates over a copy, taken when it is created, of the pairs
+// of the parent with the buffered writes and deletes applied.
+func (o *OverlayAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	iteratee, ok := o.parent.(Iteratee)
+	if !ok {
+		return &errorIterator{errors.New("[Overlay] parent adapter cannot be iterated")}
+	}
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	pairs := make(map[string][]byte)
+	it := iteratee.NewIterator(prefix, start)
+	for it.Next() {
+		pairs[string(it.Key())] = append([]byte{}, it.Value()...)
+	}
+	err := it.Error()
+	it.Release()
+	if err != nil {
+		return &errorIterator{err}
+	}
+	for key, entry := range o.entries {
+		if !hasPrefixFrom([]byte(key), prefix, start) {
+			continue
+		}
+		if entry.deleted {
+			delete(pairs, key)
+		} else {
+			pairs[key] = append([]byte{}, entry.value...)
+		}
+	}
+	kvs := make([][2][]byte, 0, len(pairs))
+	for key, value := range pairs {
+		kvs = append(kvs, [2][]byte{[]byte(key), value})
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i][0], kvs[j][0]) < 0
+	})
+	return &sliceIterator{kvs: kvs}
+}
+
+// Len returns the number of buffered writes and deletes.
+func (o *OverlayAdapter) Len() int {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	return len(o.entries)
+}
+
+// Flush writes all buffered changes to the parent in a single batch and
+// clears the overlay. On error the overlay is left untouched.
+func (o *OverlayAdapter) Flush() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	batch := NewBatch(o.parent)
+	for key, entry := range o.entries {
+		var err error
+		if entry.deleted {
+			err = batch.Delete([]byte(key))
+		} else {
+			err = batch.Put([]byte(key), entry.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err := batch.Write()
+	if err != nil {
+		return err
+	}
+	o.entries = make(map[string]overlayEntry)
+	return nil
+}
+
+// Discard drops all buffered changes.
+func (o *OverlayAdapter) Discard() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.entries = make(map[string]overlayEntry)
+}
+
+// Close does nothing: the parent adapter is owned by the caller.
+func (o *OverlayAdapter) Close() {}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOverlayAdapter(t *testing.T) {
+	parent := NewMemoryAdapter()
+	parent.Put([]byte("key1"), []byte("value1"))
+	parent.Put([]byte("key2"), []byte("value2"))
+
+	overlay := NewOverlayAdapter(parent)
+	overlay.Put([]byte("key3"), []byte("value3"))
+	err := overlay.Delete([]byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(overlay.Delete([]byte("missing")), ErrNotFound) {
+		t.Error("Expected ErrNotFound deleting a missing key")
+	}
+	if _, err := overlay.Get([]byte("key1")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted key to be hidden, got %v", err)
+	}
+	value, err := overlay.Get([]byte("key2"))
+	if err != nil || string(value) != "value2" {
+		t.Errorf("Expected read-through value2, got %s (err: %v)", value, err)
+	}
+	if parent.Has([]byte("key3")) || !parent.Has([]byte("key1")) {
+		t.Error("Overlay wrote to its parent before Flush")
+	}
+
+	var keys []string
+	it := overlay.NewIterator([]byte("key"), nil)
+	for it.Next() {
+		keys = append(keys, string(it.Key())+"="+string(it.Value()))
+	}
+	it.Release()
+	if len(keys) != 2 || keys[0] != "key2=value2" || keys[1] != "key3=value3" {
+		t.Errorf("Expected [key2=value2 key3=value3], got %v", keys)
+	}
+
+	// Stack a second overlay and discard it.
+	top := NewOverlayAdapter(overlay)
+	top.Put([]byte("key4"), []byte("value4"))
+	top.Delete([]byte("key3"))
+	if !overlay.Has([]byte("key3")) {
+		t.Error("Stacked overlay wrote to its parent before Flush")
+	}
+	top.Discard()
+	if top.Has([]byte("key4")) || !top.Has([]byte("key3")) {
+		t.Error("Discard did not drop buffered changes")
+	}
+
+	// Flush the stacked overlay into the first one, then into the parent.
+	top.Put([]byte("key5"), []byte("value5"))
+	if err := top.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := overlay.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if overlay.Len() != 0 {
+		t.Error("Flush did not clear the overlay")
+	}
+	for _, key := range []string{"key2", "key3", "key5"} {
+		if !parent.Has([]byte(key)) {
+			t.Errorf("key %s missing after Flush", key)
+		}
+	}
+	if parent.Has([]byte("key1")) {
+		t.Error("Deleted key still present after Flush")
+	}
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// PebbleAdapter stores key-value pairs in a pebble database. Single writes
+// are not synced to disk; batch writes, such as trie commits, are. Once
+// closed, every operation fails with ErrClosed, as pebble panics otherwise.
+type PebbleAdapter struct {
+	db     *pebble.DB
+	closed bool
+	lock   *sync.RWMutex
+}
+
+func NewPebbleAdapter(path string) (*PebbleAdapter, error) {
+	db, err := pebble.Open(path, &pebble.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return &PebbleAdapter{db: db, lock: &sync.RWMutex{}}, nil
+}
+
+func (p *PebbleAdapter) Get(key []byte) ([]byte, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
+	value, closer, err := p.db.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return append([]byte{}, value...), nil
+}
+
+func (p *PebbleAdapter) Put(key, value []byte) error {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	return p.db.Set(key, value, pebble.NoSync)
+}
+
+func (p *PebbleAdapter) Has(key []byte) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		return false
+	}
+	_, closer, err := p.db.Get(key)
+	if err != nil {
+		return false
+	}
+	closer.Close()
+	return true
+}
+
+func (p *PebbleAdapter) Delete(key []byte) error {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	return p.db.Delete(key, pebble.NoSync)
+}
+
+func (p *PebbleAdapter) BatchPut(kvs [][2][]byte) error {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	batch := p.db.NewBatch()
+	defer batch.Close()
+	for i := range kvs {
+		if err := batch.Set(kvs[i][0], kvs[i][1], nil); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+// pebbleBatch queues operations in memory and applies them with a pebble
+// batch that is released as soon as it is committed.
+type pebbleBatch struct {
+	batchOps
+	adapter *PebbleAdapter
+}
+
+func (p *PebbleAdapter) NewBatch() Batch {
+	return &pebbleBatch{adapter: p}
+}
+
+func (b *pebbleBatch) Write() error {
+	b.adapter.lock.RLock()
+	defer b.adapter.lock.RUnlock()
+	if b.adapter.closed {
+		return ErrClosed
+	}
+	batch := b.adapter.db.NewBatch()
+	defer batch.Close()
+	for _, op := range b.ops {
+		var err error
+		if op.delete {
+			err = batch.Delete(op.key, nil)
+		} else {
+			err = batch.Set(op.key, op.value, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+func (p *PebbleAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		return &errorIterator{ErrClosed}
+	}
+	it, err := p.db.NewIter(&pebble.IterOptions{
+		LowerBound: append(append([]byte{}, prefix...), start...),
+		UpperBound: prefixUpperBound(prefix),
+	})
+	if err != nil {
+		return &errorIterator{err}
+	}
+	return &pebbleIterator{it: it}
+}
+
+type pebbleIterator struct {
+	it      *pebble.Iterator
+	started bool
+	err     error
+}
+
+func (it *pebbleIterator) Next() bool {
+	if it.it == nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		return it.it.First()
+	}
+	return it.it.Next()
+}
+
+func (it *pebbleIterator) Key() []byte {
+	if it.it == nil || !it.it.Valid() {
+		return nil
+	}
+	return it.it.Key()
+}
+
+func (it *pebbleIterator) Value() []byte {
+	if it.it == nil || !it.it.Valid() {
+		return nil
+	}
+	return it.it.Value()
+}
+
+func (it *pebbleIterator) Error() error {
+	if it.it == nil {
+		return it.err
+	}
+	return it.it.Error()
+}
+
+// Release closes the pebble iterator. It can be called more than once.
+func (it *pebbleIterator) Release() {
+	if it.it != nil {
+		it.err = it.it.Close()
+		it.it = nil
+	}
+}
+
+// Close closes the database. It can be called more than once.
+func (p *PebbleAdapter) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.closed {
+		p.closed = true
+		p.db.Close()
+	}
+}
+
+// prefixUpperBound returns the smallest key greater than every key starting
+// with prefix, or nil if there is none.
+func prefixUpperBound(prefix []byte) []byte {
+	limit := append([]byte{}, prefix...)
+	for i := len(limit) - 1; i >= 0; i-- {
+		if limit[i] < 0xff {
+			limit[i]++
+			return limit[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestPebbleAdapter(t *testing.T) *PebbleAdapter {
+	dir, err := os.MkdirTemp("", "pebble")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	db, err := NewPebbleAdapter(filepath.Join(dir, "trie"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestPebbleAdapterReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewPebbleAdapter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.BatchPut([][2][]byte{{[]byte("key"), []byte("value")}})
+	db.Close()
+
+	db, err = NewPebbleAdapter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value, err := db.Get([]byte("key"))
+	if err != nil || string(value) != "value" {
+		t.Errorf("Expected value, got %s (err: %v)", value, err)
+	}
+}
+
+func TestPebbleIteratorPrefix(t *testing.T) {
+	db := newTestPebbleAdapter(t)
+	db.Put([]byte{0x01, 0xff}, []byte("a"))
+	db.Put([]byte{0x01, 0xff, 0x00}, []byte("b"))
+	db.Put([]byte{0x02}, []byte("c"))
+
+	var keys [][]byte
+	it := db.NewIterator([]byte{0x01, 0xff}, nil)
+	for it.Next() {
+		keys = append(keys, append([]byte{}, it.Key()...))
+	}
+	it.Release()
+	it.Release()
+	if it.Next() {
+		t.Error("Released iterator is still iterating")
+	}
+	if len(keys) != 2 || !bytes.Equal(keys[1], []byte{0x01, 0xff, 0x00}) {
+		t.Errorf("Unexpected keys %x", keys)
+	}
+	if limit := prefixUpperBound([]byte{0x01, 0xff}); !bytes.Equal(limit, []byte{0x02}) {
+		t.Errorf("Expected 02, got %x", limit)
+	}
+	if limit := prefixUpperBound([]byte{0xff}); limit != nil {
+		t.Errorf("Expected nil, got %x", limit)
+	}
+}
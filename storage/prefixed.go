@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+)
+
+// PrefixedAdapter stores all keys of an inner adapter under a fixed prefix,
+// so that several tries can share one backend in isolated namespaces. The
+// prefix is stored after its length, so that no namespace is a prefix of
+// another: "acc" and "accounts/" never see each other's keys, not even
+// when iterating.
+type PrefixedAdapter struct {
+	inner  StorageAdapter
+	prefix []byte
+}
+
+func NewPrefixedAdapter(inner StorageAdapter, prefix []byte) *PrefixedAdapter {
+	return &PrefixedAdapter{
+		inner:  inner,
+		prefix: append(binary.AppendUvarint(nil, uint64(len(prefix))), prefix...),
+	}
+}
+
+func (p *PrefixedAdapter) key(key []byte) []byte {
+	prefixed := make([]byte, 0, len(p.prefix)+len(key))
+	prefixed = append(prefixed, p.prefix...)
+	return append(prefixed, key...)
+}
+
+func (p *PrefixedAdapter) Get(key []byte) ([]byte, error) {
+	return p.GetContext(context.Background(), key)
+}
+
+func (p *PrefixedAdapter) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	return GetContext(ctx, p.inner, p.key(key))
+}
+
+func (p *PrefixedAdapter) Put(key, value []byte) error {
+	return p.PutContext(context.Background(), key, value)
+}
+
+func (p *PrefixedAdapter) PutContext(ctx context.Context, key, value []byte) error {
+	return PutContext(ctx, p.inner, p.key(key), value)
+}
+
+func (p *PrefixedAdapter) Has(key []byte) bool {
+	has, _ := p.HasContext(context.Background(), key)
+	return has
+}
+
+func (p *PrefixedAdapter) HasContext(ctx context.Context, key []byte) (bool, error) {
+	return HasContext(ctx, p.inner, p.key(key))
+}
+
+func (p *PrefixedAdapter) Delete(key []byte) error {
+	return p.DeleteContext(context.Background(), key)
+}
+
+func (p *PrefixedAdapter) DeleteContext(ctx context.Context, key []byte) error {
+	return DeleteContext(ctx, p.inner, p.key(key))
+}
+
+func (p *PrefixedAdapter) BatchPut(kvs [][2][]byte) error {
+	return p.BatchPutContext(context.Background(), kvs)
+}
+
+func (p *PrefixedAdapter) BatchPutContext(ctx context.Context, kvs [][2][]byte) error {
+	prefixed := make([][2][]byte, len(kvs))
+	for i := range kvs {
+		prefixed[i] = [2][]byte{p.key(kvs[i][0]), kvs[i][1]}
+	}
+	return BatchPutContext(ctx, p.inner, prefixed)
+}
+
+func (p *PrefixedAdapter) NewBatch() Batch {
+	return &prefixedBatch{NewBatch(p.inner), p}
+}
+
+func (p *PrefixedAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	iteratee, ok := p.inner.(Iteratee)
+	if !ok {
+		return &errorIterator{errors.New("[Prefixed] inner adapter cannot be iterated")}
+	}
+	return &prefixedIterator{iteratee.NewIterator(p.key(prefix), start), len(p.prefix)}
+}
+
+// Close does nothing: the inner adapter is shared and closed by its owner.
+func (p *PrefixedAdapter) Close() {}
+
+type prefixedBatch struct {
+	Batch
+	adapter *PrefixedAdapter
+}
+
+func (b *prefixedBatch) Put(key, value []byte) error {
+	return b.Batch.Put(b.adapter.key(key), value)
+}
+
+func (b *prefixedBatch) Delete(key []byte) error {
+	return b.Batch.Delete(b.adapter.key(key))
+}
+
+func (b *prefixedBatch) Replay(w KeyValueWriter) error {
+	return b.Batch.Replay(&prefixStripper{w, len(b.adapter.prefix)})
+}
+
+// prefixStripper removes the namespace prefix from replayed keys.
+type prefixStripper struct {
+	w      KeyValueWriter
+	prefix int
+}
+
+func (s *prefixStripper) Put(key, value []byte) error {
+	return s.w.Put(key[s.prefix:], value)
+}
+
+func (s *prefixStripper) Delete(key []byte) error {
+	return s.w.Delete(key[s.prefix:])
+}
+
+type prefixedIterator struct {
+	Iterator
+	prefix int
+}
+
+func (it *prefixedIterator) Key() []byte {
+	key := it.Iterator.Key()
+	if key == nil {
+		return nil
+	}
+	return key[it.prefix:]
+}
@@ -0,0 +1,81 @@
+package storage
+
+import "testing"
+
+func TestPrefixedAdapter(t *testing.T) {
+	inner := NewMemoryAdapter()
+	accounts := NewPrefixedAdapter(inner, []byte("a/"))
+	receipts := NewPrefixedAdapter(inner, []byte("r/"))
+
+	accounts.Put([]byte("key1"), []byte("account1"))
+	receipts.BatchPut([][2][]byte{
+		{[]byte("key1"), []byte("receipt1")},
+		{[]byte("key2"), []byte("receipt2")},
+	})
+	value, err := accounts.Get([]byte("key1"))
+	if err != nil || string(value) != "account1" {
+		t.Fatalf("Expected account1, got %s (err: %v)", value, err)
+	}
+	value, err = receipts.Get([]byte("key1"))
+	if err != nil || string(value) != "receipt1" {
+		t.Fatalf("Expected receipt1, got %s (err: %v)", value, err)
+	}
+	if accounts.Has([]byte("key2")) {
+		t.Error("Namespaces are not isolated")
+	}
+	if !inner.Has([]byte("\x02r/key2")) {
+		t.Error("Key was not prefixed in the inner adapter")
+	}
+
+	batch := accounts.NewBatch()
+	batch.Put([]byte("key3"), []byte("account3"))
+	batch.Delete([]byte("key1"))
+	err = batch.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accounts.Has([]byte("key1")) || !receipts.Has([]byte("key1")) {
+		t.Error("Batch delete leaked across namespaces")
+	}
+	replayed := NewMemoryAdapter()
+	replayed.Put([]byte("key1"), nil)
+	err = batch.Replay(replayed)
+	if err != nil || !replayed.Has([]byte("key3")) {
+		t.Errorf("Replay did not strip the prefix (err: %v)", err)
+	}
+
+	var keys []string
+	it := receipts.NewIterator([]byte("key"), nil)
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Release()
+	if len(keys) != 2 || keys[0] != "key1" || keys[1] != "key2" {
+		t.Errorf("Expected [key1 key2], got %v", keys)
+	}
+
+	it = NewPrefixedAdapter(plainAdapter{inner}, []byte("a/")).NewIterator(nil, nil)
+	if it.Next() || it.Error() == nil {
+		t.Error("Expected iteration error for a non-iterable inner adapter")
+	}
+}
+
+func TestPrefixedAdapterNestedPrefixes(t *testing.T) {
+	inner := NewMemoryAdapter()
+	short := NewPrefixedAdapter(inner, []byte("acc"))
+	long := NewPrefixedAdapter(inner, []byte("accounts/"))
+	short.Put([]byte("key1"), []byte("short"))
+	long.Put([]byte("key2"), []byte("long"))
+
+	for name, store := range map[string]*PrefixedAdapter{"acc": short, "accounts/": long} {
+		var keys []string
+		it := store.NewIterator(nil, nil)
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+		it.Release()
+		if len(keys) != 1 {
+			t.Errorf("%s: Expected a single key, got %q", name, keys)
+		}
+	}
+}
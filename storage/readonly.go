@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// ReadOnlyAdapter forwards reads to an inner adapter and rejects writes with
+// ErrReadOnly.
+type ReadOnlyAdapter struct {
+	inner StorageAdapter
+}
+
+// ReadOnly wraps inner so that it cannot be written through the returned
+// adapter.
+func ReadOnly(inner StorageAdapter) *ReadOnlyAdapter {
+	return &ReadOnlyAdapter{inner}
+}
+
+func (r *ReadOnlyAdapter) Get(key []byte) ([]byte, error) {
+	return r.inner.Get(key)
+}
+
+func (r *ReadOnlyAdapter) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	return GetContext(ctx, r.inner, key)
+}
+
+func (r *ReadOnlyAdapter) PutContext(ctx context.Context, key, value []byte) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyAdapter) HasContext(ctx context.Context, key []byte) (bool, error) {
+	return HasContext(ctx, r.inner, key)
+}
+
+func (r *ReadOnlyAdapter) DeleteContext(ctx context.Context, key []byte) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyAdapter) BatchPutContext(ctx context.Context, kvs [][2][]byte) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyAdapter) Put(key, value []byte) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyAdapter) Has(key []byte) bool {
+	return r.inner.Has(key)
+}
+
+func (r *ReadOnlyAdapter) Delete(key []byte) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyAdapter) BatchPut(kvs [][2][]byte) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	iteratee, ok := r.inner.(Iteratee)
+	if !ok {
+		return &errorIterator{errors.New("[ReadOnly] inner adapter cannot be iterated")}
+	}
+	return iteratee.NewIterator(prefix, start)
+}
+
+func (r *ReadOnlyAdapter) Close() {
+	r.inner.Close()
+}
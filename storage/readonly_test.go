@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadOnlyAdapter(t *testing.T) {
+	inner := NewMemoryAdapter()
+	inner.Put([]byte("key1"), []byte("value1"))
+	store := ReadOnly(inner)
+
+	value, err := store.Get([]byte("key1"))
+	if err != nil || string(value) != "value1" {
+		t.Fatalf("Expected value1, got %s (err: %v)", value, err)
+	}
+	if err := store.Put([]byte("key2"), []byte("value2")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly on Put, got %v", err)
+	}
+	if err := store.Delete([]byte("key1")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly on Delete, got %v", err)
+	}
+	if err := store.BatchPut([][2][]byte{{[]byte("key2"), []byte("value2")}}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly on BatchPut, got %v", err)
+	}
+	batch := NewBatch(store)
+	batch.Put([]byte("key2"), []byte("value2"))
+	if err := batch.Write(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly on batch Write, got %v", err)
+	}
+	if inner.Has([]byte("key2")) || !inner.Has([]byte("key1")) {
+		t.Error("Inner adapter was modified")
+	}
+
+	it := store.NewIterator(nil, nil)
+	if !it.Next() || string(it.Key()) != "key1" || it.Next() {
+		t.Error("Iterator does not match the inner adapter")
+	}
+	it.Release()
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultShards is the number of shards used by NewShardedMemoryAdapter when
+// none is given.
+const DefaultShards = 32
+
+// ShardedMemoryAdapter keeps key-value pairs in memory like MemoryAdapter,
+// but spreads them over shards with their own lock so that concurrent
+// operations on different keys rarely contend. Keys are stored as raw byte
+// strings and values are copied on the way in and out.
+type ShardedMemoryAdapter struct {
+	shards []memoryShard
+}
+
+type memoryShard struct {
+	store map[string][]byte
+	lock  sync.RWMutex
+}
+
+func NewShardedMemoryAdapter(shards int) *ShardedMemoryAdapter {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+	s := &ShardedMemoryAdapter{shards: make([]memoryShard, shards)}
+	for i := range s.shards {
+		s.shards[i].store = make(map[string][]byte)
+	}
+	return s
+}
+
+// shardIndex hashes key with 32-bit FNV-1a.
+func (s *ShardedMemoryAdapter) shardIndex(key []byte) int {
+	hash := uint32(2166136261)
+	for _, b := range key {
+		hash ^= uint32(b)
+		hash *= 16777619
+	}
+	return int(hash % uint32(len(s.shards)))
+}
+
+func (s *ShardedMemoryAdapter) shard(key []byte) *memoryShard {
+	return &s.shards[s.shardIndex(key)]
+}
+
+func (s *ShardedMemoryAdapter) Get(key []byte) ([]byte, error) {
+	shard := s.shard(key)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	if v, ok := shard.store[string(key)]; ok {
+		return append([]byte{}, v...), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *ShardedMemoryAdapter) Put(key, value []byte) error {
+	shard := s.shard(key)
+	value = append([]byte{}, value...)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	shard.store[string(key)] = value
+	return nil
+}
+
+func (s *ShardedMemoryAdapter) Has(key []byte) bool {
+	shard := s.shard(key)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	_, ok := shard.store[string(key)]
+	return ok
+}
+
+func (s *ShardedMemoryAdapter) Delete(key []byte) error {
+	shard := s.shard(key)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if _, ok := shard.store[string(key)]; !ok {
+		return fmt.Errorf("[MemKV] %w: %x", ErrNotFound, key)
+	}
+	delete(shard.store, string(key))
+	return nil
+}
+
+// lockShards write-locks the shards of keys in index order, so that
+// concurrent batches cannot deadlock, and returns a function unlocking them.
+func (s *ShardedMemoryAdapter) lockShards(keys [][]byte) func() {
+	locked := make([]bool, len(s.shards))
+	for _, key := range keys {
+		locked[s.shardIndex(key)] = true
+	}
+	for i := range s.shards {
+		if locked[i] {
+			s.shards[i].lock.Lock()
+		}
+	}
+	return func() {
+		for i := range s.shards {
+			if locked[i] {
+				s.shards[i].lock.Unlock()
+			}
+		}
+	}
+}
+
+// BatchPut applies all pairs at once: readers see either none or all of
+// them.
+func (s *ShardedMemoryAdapter) BatchPut(kvs [][2][]byte) error {
+	ops := make([]batchOp, len(kvs))
+	for i := range kvs {
+		ops[i] = batchOp{key: kvs[i][0], value: append([]byte{}, kvs[i][1]...)}
+	}
+	s.apply(ops)
+	return nil
+}
+
+// apply writes batch operations whose values are already copied.
+func (s *ShardedMemoryAdapter) apply(ops []batchOp) {
+	keys := make([][]byte, len(ops))
+	for i := range ops {
+		keys[i] = ops[i].key
+	}
+	unlock := s.lockShards(keys)
+	defer unlock()
+	for _, op := range ops {
+		shard := s.shard(op.key)
+		if op.delete {
+			delete(shard.store, string(op.key))
+		} else {
+			shard.store[string(op.key)] = op.value
+		}
+	}
+}
+
+type shardedBatch struct {
+	batchOps
+	s *ShardedMemoryAdapter
+}
+
+func (s *ShardedMemoryAdapter) NewBatch() Batch {
+	return &shardedBatch{s: s}
+}
+
+func (b *shardedBatch) Write() error {
+	// values are copied again as the batch may be reset and reused
+	ops := make([]batchOp, len(b.ops))
+	for i, op := range b.ops {
+		ops[i] = batchOp{key: op.key, value: append([]byte{}, op.value...), delete: op.delete}
+	}
+	b.s.apply(ops)
+	return nil
+}
+
+// NewIterator returns an iterator over a sorted copy of the matching keys,
+// taken with every shard locked.
+func (s *ShardedMemoryAdapter) NewIterator(prefix []byte, start []byte) Iterator {
+	for i := range s.shards {
+		s.shards[i].lock.RLock()
+	}
+	var kvs [][2][]byte
+	for i := range s.shards {
+		for key, value := range s.shards[i].store {
+			if hasPrefixFrom([]byte(key), prefix, start) {
+				kvs = append(kvs, [2][]byte{[]byte(key), append([]byte{}, value...)})
+			}
+		}
+	}
+	for i := range s.shards {
+		s.shards[i].lock.RUnlock()
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i][0], kvs[j][0]) < 0
+	})
+	return &sliceIterator{kvs: kvs}
+}
+
+// Len returns the number of stored keys.
+func (s *ShardedMemoryAdapter) Len() int {
+	n := 0
+	for i := range s.shards {
+		s.shards[i].lock.RLock()
+		n += len(s.shards[i].store)
+		s.shards[i].lock.RUnlock()
+	}
+	return n
+}
+
+func (s *ShardedMemoryAdapter) Close() {}
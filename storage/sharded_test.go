@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestShardedMemoryAdapter(t *testing.T) {
+	s := NewShardedMemoryAdapter(4)
+	value := []byte("value")
+	s.Put([]byte("key"), value)
+	value[0] = 'V'
+	got, _ := s.Get([]byte("key"))
+	if string(got) != "value" {
+		t.Errorf("Expected value, got %s", got)
+	}
+	got[0] = 'V'
+	got, _ = s.Get([]byte("key"))
+	if string(got) != "value" {
+		t.Errorf("Returned value aliases the stored one, got %s", got)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := []byte{byte(w), byte(i)}
+				s.BatchPut([][2][]byte{{key, key}, {append(key, 0), key}})
+				if !s.Has(key) {
+					t.Errorf("Missing key %x", key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if s.Len() != 8*100*2+1 {
+		t.Errorf("Expected %d keys, got %d", 8*100*2+1, s.Len())
+	}
+}
+
+// silenceLog discards the per-key logging of MemoryAdapter.BatchPut for the
+// duration of a benchmark.
+func silenceLog(b *testing.B) {
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+func benchmarkKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = binary.BigEndian.AppendUint64(make([]byte, 24), uint64(i))
+	}
+	return keys
+}
+
+func benchmarkParallelPut(b *testing.B, store StorageAdapter) {
+	keys := benchmarkKeys(1024)
+	value := make([]byte, 128)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			store.Put(keys[i%len(keys)], value)
+			i++
+		}
+	})
+}
+
+func benchmarkParallelGet(b *testing.B, store StorageAdapter) {
+	keys := benchmarkKeys(1024)
+	for _, key := range keys {
+		store.Put(key, make([]byte, 128))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			store.Get(keys[i%len(keys)])
+			i++
+		}
+	})
+}
+
+func benchmarkBatchPut(b *testing.B, store StorageAdapter) {
+	silenceLog(b)
+	keys := benchmarkKeys(64)
+	kvs := make([][2][]byte, len(keys))
+	for i, key := range keys {
+		kvs[i] = [2][]byte{key, make([]byte, 128)}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.BatchPut(kvs)
+	}
+}
+
+func BenchmarkMemoryAdapterParallelPut(b *testing.B) {
+	benchmarkParallelPut(b, NewMemoryAdapter())
+}
+
+func BenchmarkShardedAdapterParallelPut(b *testing.B) {
+	benchmarkParallelPut(b, NewShardedMemoryAdapter(0))
+}
+
+func BenchmarkMemoryAdapterParallelGet(b *testing.B) {
+	benchmarkParallelGet(b, NewMemoryAdapter())
+}
+
+func BenchmarkShardedAdapterParallelGet(b *testing.B) {
+	benchmarkParallelGet(b, NewShardedMemoryAdapter(0))
+}
+
+func BenchmarkMemoryAdapterBatchPut(b *testing.B) {
+	benchmarkBatchPut(b, NewMemoryAdapter())
+}
+
+func BenchmarkShardedAdapterBatchPut(b *testing.B) {
+	benchmarkBatchPut(b, NewShardedMemoryAdapter(0))
+}
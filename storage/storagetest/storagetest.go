@@ -0,0 +1,300 @@
+// Package storagetest provides a conformance suite for implementations of
+// storage.StorageAdapter.
+package storagetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/vldmkr/merkle-patricia-trie/storage"
+)
+
+// Factory returns a new, empty adapter. It is called once per subtest and
+// may register cleanups with t, but must not close the adapter: Run closes
+// every adapter it opens.
+type Factory func(t *testing.T) storage.StorageAdapter
+
+// Run checks that the adapters returned by newStore behave as every
+// StorageAdapter must, and as storage.Iteratee and storage.Batcher require
+// when they implement them.
+//
+// Deleting a missing key may either succeed or fail with
+// storage.ErrNotFound. Values passed to Put and BatchPut and returned by Get
+// must not be shared with the adapter. Close may be called more than once;
+// after it, operations may fail or keep working, but must not panic or
+// return wrong values.
+func Run(t *testing.T, newStore Factory) {
+	open := func(t *testing.T) storage.StorageAdapter {
+		store := newStore(t)
+		t.Cleanup(store.Close)
+		return store
+	}
+	t.Run("GetPut", func(t *testing.T) { testGetPut(t, open(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, open(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, open(t)) })
+	t.Run("BatchPut", func(t *testing.T) { testBatchPut(t, open(t)) })
+	t.Run("Aliasing", func(t *testing.T) { testAliasing(t, open(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, open(t)) })
+	t.Run("Iterator", func(t *testing.T) { testIterator(t, open(t)) })
+	t.Run("Batch", func(t *testing.T) { testBatch(t, open(t)) })
+	t.Run("Close", func(t *testing.T) { testClose(t, open(t)) })
+}
+
+func expectValue(t *testing.T, store storage.StorageAdapter, key, expected string) {
+	t.Helper()
+	value, err := store.Get([]byte(key))
+	if err != nil || string(value) != expected {
+		t.Errorf("Expected %s for %s, got %s (err: %v)", expected, key, value, err)
+	}
+}
+
+func testGetPut(t *testing.T, store storage.StorageAdapter) {
+	err := store.Put([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, store, "key", "value")
+	if !store.Has([]byte("key")) {
+		t.Error("Has does not find a stored key")
+	}
+	err = store.Put([]byte("key"), []byte("updated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, store, "key", "updated")
+
+	// keys are binary and may be prefixes of each other
+	store.Put([]byte{0x00}, []byte("zero"))
+	store.Put([]byte{0x00, 0x00}, []byte("double zero"))
+	store.Put([]byte{0xff, 0x00, 0x7f}, []byte("binary"))
+	expectValue(t, store, "\x00", "zero")
+	expectValue(t, store, "\x00\x00", "double zero")
+	expectValue(t, store, "\xff\x00\x7f", "binary")
+}
+
+func testNotFound(t *testing.T, store storage.StorageAdapter) {
+	value, err := store.Get([]byte("missing"))
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if value != nil {
+		t.Errorf("Expected no value, got %s", value)
+	}
+	if store.Has([]byte("missing")) {
+		t.Error("Has finds a missing key")
+	}
+}
+
+func testDelete(t *testing.T, store storage.StorageAdapter) {
+	store.Put([]byte("key"), []byte("value"))
+	store.Put([]byte("other"), []byte("value"))
+	err := store.Delete([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Has([]byte("key")) {
+		t.Error("Delete did not remove the key")
+	}
+	if _, err := store.Get([]byte("key")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after Delete, got %v", err)
+	}
+	expectValue(t, store, "other", "value")
+
+	err = store.Delete([]byte("missing"))
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected nil or ErrNotFound deleting a missing key, got %v", err)
+	}
+	store.Put([]byte("key"), []byte("again"))
+	expectValue(t, store, "key", "again")
+}
+
+func testBatchPut(t *testing.T, store storage.StorageAdapter) {
+	store.Put([]byte("key1"), []byte("old"))
+	err := store.BatchPut([][2][]byte{
+		{[]byte("key1"), []byte("value1")},
+		{[]byte("key2"), []byte("value2")},
+		{[]byte("key3"), []byte("value3")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, store, "key1", "value1")
+	expectValue(t, store, "key2", "value2")
+	expectValue(t, store, "key3", "value3")
+
+	err = store.BatchPut(nil)
+	if err != nil {
+		t.Errorf("Expected an empty BatchPut to succeed, got %v", err)
+	}
+}
+
+func testAliasing(t *testing.T, store storage.StorageAdapter) {
+	value := []byte("value1")
+	store.Put([]byte("key1"), value)
+	value[0] = 'X'
+	expectValue(t, store, "key1", "value1")
+
+	kvs := [][2][]byte{{[]byte("key2"), []byte("value2")}}
+	store.BatchPut(kvs)
+	kvs[0][1][0] = 'X'
+	expectValue(t, store, "key2", "value2")
+
+	got, err := store.Get([]byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got[0] = 'X'
+	expectValue(t, store, "key1", "value1")
+}
+
+func testConcurrency(t *testing.T, store storage.StorageAdapter) {
+	const workers = 8
+	const keys = 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				key := []byte(fmt.Sprintf("key-%d-%d", w, i))
+				var err error
+				if i%2 == 0 {
+					err = store.Put(key, key)
+				} else {
+					err = store.BatchPut([][2][]byte{{key, key}})
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				value, err := store.Get(key)
+				if err != nil || !bytes.Equal(value, key) {
+					t.Errorf("Expected %s, got %s (err: %v)", key, value, err)
+					return
+				}
+				store.Has([]byte("shared"))
+			}
+		}(w)
+	}
+	wg.Wait()
+	for w := 0; w < workers; w++ {
+		for i := 0; i < keys; i++ {
+			if key := []byte(fmt.Sprintf("key-%d-%d", w, i)); !store.Has(key) {
+				t.Fatalf("Missing %s after concurrent writes", key)
+			}
+		}
+	}
+}
+
+func testIterator(t *testing.T, store storage.StorageAdapter) {
+	iteratee, ok := store.(storage.Iteratee)
+	if !ok {
+		t.Skip("adapter cannot be iterated")
+	}
+	for _, key := range []string{"b2", "a1", "b1", "b3", "c1"} {
+		store.Put([]byte(key), []byte("value-"+key))
+	}
+	var keys []string
+	it := iteratee.NewIterator([]byte("b"), []byte("2"))
+	for it.Next() {
+		if !bytes.Equal(it.Value(), []byte("value-"+string(it.Key()))) {
+			t.Errorf("Unexpected value %s for %s", it.Value(), it.Key())
+		}
+		keys = append(keys, string(it.Key()))
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	it.Release()
+	if len(keys) != 2 || keys[0] != "b2" || keys[1] != "b3" {
+		t.Errorf("Expected [b2 b3], got %v", keys)
+	}
+
+	keys = nil
+	it = iteratee.NewIterator(nil, nil)
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Release()
+	if len(keys) != 5 || keys[0] != "a1" || keys[4] != "c1" {
+		t.Errorf("Expected all keys in order, got %v", keys)
+	}
+}
+
+func testBatch(t *testing.T, store storage.StorageAdapter) {
+	if _, ok := store.(storage.Batcher); !ok {
+		t.Skip("adapter has no native batches")
+	}
+	store.Put([]byte("old"), []byte("value"))
+
+	batch := storage.NewBatch(store)
+	batch.Put([]byte("key1"), []byte("value1"))
+	batch.Delete([]byte("old"))
+	batch.Put([]byte("key2"), []byte("value2"))
+	batch.Delete([]byte("key2"))
+	batch.Delete([]byte("missing"))
+	if batch.ValueSize() == 0 {
+		t.Error("Batch size does not account for queued operations")
+	}
+	if store.Has([]byte("key1")) {
+		t.Error("Batch applied before Write")
+	}
+	err := batch.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, store, "key1", "value1")
+	if store.Has([]byte("old")) || store.Has([]byte("key2")) {
+		t.Error("Batch delete was not applied")
+	}
+
+	replayed := storage.NewMemoryAdapter()
+	replayed.Put([]byte("old"), []byte("value"))
+	replayed.Put([]byte("missing"), []byte("value"))
+	err = batch.Replay(replayed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replayed.Has([]byte("key1")) || replayed.Has([]byte("old")) {
+		t.Error("Replay did not apply the batch")
+	}
+
+	batch.Reset()
+	if batch.ValueSize() != 0 {
+		t.Error("Reset did not clear the batch")
+	}
+	batch.Put([]byte("key3"), []byte("value3"))
+	err = batch.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, store, "key3", "value3")
+}
+
+// testClose closes store once itself, and once more in the cleanup of Run.
+func testClose(t *testing.T, store storage.StorageAdapter) {
+	err := store.Put([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	value, err := store.Get([]byte("key"))
+	if err == nil && string(value) != "value" {
+		t.Errorf("Expected value or an error after Close, got %s", value)
+	}
+	_, err = store.Get([]byte("missing"))
+	if err == nil {
+		t.Error("Expected an error for a missing key after Close")
+	}
+	store.Has([]byte("key"))
+	err = store.Put([]byte("key"), []byte("other"))
+	if err == nil {
+		expectValue(t, store, "key", "other")
+	}
+	store.Delete([]byte("key"))
+	store.BatchPut([][2][]byte{{[]byte("key"), []byte("value")}})
+}
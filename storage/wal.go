@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCheckpointSize is the log size in bytes after which a MemoryAdapter
+// with a write-ahead log writes a checkpoint.
+const DefaultCheckpointSize = 4 << 20
+
+const (
+	walFileName        = "wal"
+	checkpointFileName = "checkpoint"
+)
+
+// WALOptions tunes the write-ahead log of a MemoryAdapter.
+type WALOptions struct {
+	// CheckpointSize is the log size in bytes after which a checkpoint is
+	// written and the log emptied. Zero uses DefaultCheckpointSize and a
+	// negative size disables automatic checkpoints.
+	CheckpointSize int64
+}
+
+// memoryWAL logs the writes of a MemoryAdapter with the records of
+// FileLogAdapter. The directory holds a checkpoint with every pair at some
+// point in time and the log of the writes made since.
+type memoryWAL struct {
+	dir            string
+	file           *os.File
+	size           int64
+	checkpointSize int64
+}
+
+// NewMemoryAdapterWithWAL returns a MemoryAdapter whose writes are logged to
+// dir and synced to disk before they are applied, one sync per call or
+// batch. The content of a previous adapter using dir is restored from its
+// last checkpoint and log.
+func NewMemoryAdapterWithWAL(dir string, opts *WALOptions) (*MemoryAdapter, error) {
+	if opts == nil {
+		opts = &WALOptions{}
+	}
+	checkpointSize := opts.CheckpointSize
+	if checkpointSize == 0 {
+		checkpointSize = DefaultCheckpointSize
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	kv := NewMemoryAdapter()
+	err = kv.replay(filepath.Join(dir, checkpointFileName), false)
+	if err != nil {
+		return nil, err
+	}
+	walPath := filepath.Join(dir, walFileName)
+	err = kv.replay(walPath, true)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(walPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	kv.wal = &memoryWAL{dir, file, info.Size(), checkpointSize}
+	return kv, nil
+}
+
+// replay applies the records of a log file to the store. A torn record ends
+// the log; it is truncated away if truncate is set and an error otherwise.
+// A corrupted record is always an error.
+func (kv *MemoryAdapter) replay(path string, truncate bool) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var offset int64
+	r := bufio.NewReader(file)
+	for {
+		record, err := readLogRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			err = replayLogRecord(record, func(kind byte, key, value []byte, _ int64) {
+				if kind == recordDelete {
+					delete(kv.store, hex.EncodeToString(key))
+				} else {
+					kv.store[hex.EncodeToString(key)] = value
+				}
+			})
+		}
+		if err == errTornRecord && truncate {
+			err = file.Truncate(offset)
+			if err == nil {
+				err = file.Sync()
+			}
+			return err
+		} else if err != nil {
+			return fmt.Errorf("[MemKV] Cannot replay %s: %w", path, err)
+		}
+		offset += int64(logHeaderSize + len(record.key) + len(record.value))
+	}
+}
+
+// logWrite appends an encoded record to the log and syncs it. The caller
+// holds the write lock and applies the record once it is logged.
+func (kv *MemoryAdapter) logWrite(record []byte) error {
+	w := kv.wal
+	_, err := w.file.WriteAt(record, w.size)
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		// drop whatever part of the record was written
+		w.file.Truncate(w.size)
+		return fmt.Errorf("[MemKV] Cannot write log: %w", err)
+	}
+	w.size += int64(len(record))
+	return nil
+}
+
+// maybeCheckpoint writes a checkpoint once the log outgrows its limit. The
+// caller holds the write lock and has already logged its write, which is
+// durable whether or not the checkpoint succeeds: a failed checkpoint keeps
+// the log and is retried on the next write.
+func (kv *MemoryAdapter) maybeCheckpoint() {
+	if kv.wal.checkpointSize < 0 || kv.wal.size < kv.wal.checkpointSize {
+		return
+	}
+	err := kv.checkpoint()
+	if err != nil {
+		log.Printf("[MemKV] Checkpoint failed, keeping the log: %v", err)
+	}
+}
+
+// Checkpoint writes every pair to a new checkpoint and empties the log. It
+// fails if the adapter has no write-ahead log.
+func (kv *MemoryAdapter) Checkpoint() error {
+	if kv.wal == nil {
+		return errors.New("[MemKV] no write-ahead log")
+	}
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	return kv.checkpoint()
+}
+
+func (kv *MemoryAdapter) checkpoint() error {
+	w := kv.wal
+	tmpPath := filepath.Join(w.dir, checkpointFileName+".tmp")
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	bw := bufio.NewWriter(tmp)
+	var record []byte
+	for keyHex, value := range kv.store {
+		key, _ := hex.DecodeString(keyHex)
+		record = appendLogRecord(record[:0], recordPut, key, value)
+		_, err = bw.Write(record)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	err = bw.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, filepath.Join(w.dir, checkpointFileName))
+	if err != nil {
+		return err
+	}
+	err = syncDir(w.dir)
+	if err != nil {
+		return err
+	}
+
+	// replaying the log over the new checkpoint gives the same store, so a
+	// crash before the log is emptied loses nothing
+	err = w.file.Truncate(0)
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("[MemKV] Cannot empty log: %w", err)
+	}
+	w.size = 0
+	return nil
+}
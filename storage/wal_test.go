@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryWALReplay(t *testing.T) {
+	dir := t.TempDir()
+	kv, err := NewMemoryAdapterWithWAL(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.Put([]byte("key1"), []byte("value1"))
+	kv.BatchPut([][2][]byte{{[]byte("key2"), []byte("value2")}, {[]byte("key3"), []byte("value3")}})
+	batch := kv.NewBatch()
+	batch.Put([]byte("key4"), []byte("value4"))
+	batch.Delete([]byte("key2"))
+	batch.Write()
+	kv.Delete([]byte("key3"))
+	kv.Close()
+
+	kv, err = NewMemoryAdapterWithWAL(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	for key, expected := range map[string]string{"key1": "value1", "key4": "value4"} {
+		value, err := kv.Get([]byte(key))
+		if err != nil || string(value) != expected {
+			t.Errorf("Expected %s, got %s (err: %v)", expected, value, err)
+		}
+	}
+	if kv.Has([]byte("key2")) || kv.Has([]byte("key3")) {
+		t.Error("Deleted keys are back after replay")
+	}
+}
+
+func TestMemoryWALCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	kv, err := NewMemoryAdapterWithWAL(dir, &WALOptions{CheckpointSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		kv.Put([]byte{byte(i)}, []byte("value"))
+	}
+	if kv.wal.size >= 64 {
+		t.Errorf("Expected the log to be checkpointed, size is %d", kv.wal.size)
+	}
+	if _, err := os.Stat(filepath.Join(dir, checkpointFileName)); err != nil {
+		t.Fatal(err)
+	}
+	kv.Delete([]byte{0})
+	kv.Close()
+
+	kv, err = NewMemoryAdapterWithWAL(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv.Has([]byte{0}) || !kv.Has([]byte{9}) {
+		t.Error("Checkpoint and log were not both replayed")
+	}
+	err = kv.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv.wal.size != 0 {
+		t.Errorf("Expected an empty log, size is %d", kv.wal.size)
+	}
+	kv.Close()
+
+	kv, err = NewMemoryAdapterWithWAL(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	if len(kv.store) != 9 {
+		t.Errorf("Expected 9 keys, got %d", len(kv.store))
+	}
+
+	if err := NewMemoryAdapter().Checkpoint(); err == nil {
+		t.Error("Expected an error without a write-ahead log")
+	}
+}
+
+func TestMemoryWALTornTail(t *testing.T) {
+	dir := t.TempDir()
+	kv, err := NewMemoryAdapterWithWAL(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.Put([]byte("key1"), []byte("value1"))
+	size := kv.wal.size
+	kv.Put([]byte("key2"), []byte("value2"))
+	kv.Close()
+
+	os.Truncate(filepath.Join(dir, walFileName), size+5)
+	kv, err = NewMemoryAdapterWithWAL(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	if !kv.Has([]byte("key1")) || kv.Has([]byte("key2")) {
+		t.Error("Torn record was not dropped")
+	}
+	if kv.wal.size != size {
+		t.Errorf("Expected log size %d, got %d", size, kv.wal.size)
+	}
+}
+
+func TestMemoryWALCorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	kv, err := NewMemoryAdapterWithWAL(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.Put([]byte("key1"), []byte("value1"))
+	size := kv.wal.size
+	kv.Put([]byte("key2"), []byte("value2"))
+	kv.Put([]byte("key3"), []byte("value3"))
+	kv.Close()
+
+	// flip the low byte of the key length of the second record
+	path := filepath.Join(dir, walFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[size+8] ^= 0x01
+	os.WriteFile(path, data, 0644)
+
+	_, err = NewMemoryAdapterWithWAL(dir, nil)
+	if !errors.Is(err, errCorruptRecord) {
+		t.Errorf("Expected a corruption error, got %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(data)) {
+		t.Errorf("Expected the log to be kept at %d bytes, got %d", len(data), info.Size())
+	}
+}
+
+func TestMemoryWALCheckpointFailure(t *testing.T) {
+	dir := t.TempDir()
+	kv, err := NewMemoryAdapterWithWAL(dir, &WALOptions{CheckpointSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	// a directory in place of the temporary checkpoint makes it fail
+	blocker := filepath.Join(dir, checkpointFileName+".tmp")
+	os.Mkdir(blocker, 0755)
+	os.WriteFile(filepath.Join(blocker, "file"), nil, 0644)
+
+	err = kv.Put([]byte("key1"), []byte("value1"))
+	if err != nil {
+		t.Fatalf("Expected the logged write to succeed, got %v", err)
+	}
+	if kv.wal.size == 0 {
+		t.Errorf("Expected the log to be kept, size is %d", kv.wal.size)
+	}
+
+	os.RemoveAll(blocker)
+	kv.Put([]byte("key2"), []byte("value2"))
+	if kv.wal.size != 0 {
+		t.Errorf("Expected the checkpoint to be retried, log size is %d", kv.wal.size)
+	}
+	if !kv.Has([]byte("key1")) || !kv.Has([]byte("key2")) {
+		t.Error("Writes were lost")
+	}
+}